@@ -4,13 +4,95 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"net"
+	"net/netip"
 	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
 
 	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/envutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+const (
+	// AddressIPv4 selects the instance public IPv4 address.
+	AddressIPv4 = "ipv4"
+	// AddressIPv6 selects the instance public IPv6 address.
+	AddressIPv6 = "ipv6"
+	// AddressInternal selects the instance internal address.
+	AddressInternal = "internal"
+)
+
+var addressPreferences = []string{AddressIPv4, AddressIPv6, AddressInternal}
+
+var defaultAddressPreference = []string{AddressIPv4, AddressIPv6}
+
+var volumeFormats = []string{"ext4", "xfs"}
+
+const (
+	// CreationTimeoutDelete deletes the instances stuck in creation.
+	CreationTimeoutDelete = "delete"
+	// CreationTimeoutReport reports the instances stuck in creation as timed out, and
+	// keeps their server for inspection.
+	CreationTimeoutReport = "report"
 )
 
+var creationTimeoutPolicies = []string{CreationTimeoutDelete, CreationTimeoutReport}
+
+const (
+	// MaxInstanceAgeHeartbeat fails the heartbeat of the expired instances, which removes
+	// them once they are idle.
+	MaxInstanceAgeHeartbeat = "heartbeat"
+	// MaxInstanceAgeReport also reports the expired instances as deleting during the
+	// updates, so the runner removes them, even if they are in use.
+	MaxInstanceAgeReport = "report"
+)
+
+var maxInstanceAgePolicies = []string{MaxInstanceAgeHeartbeat, MaxInstanceAgeReport}
+
+const defaultBillingBoundaryMargin = 5 * time.Minute
+
+// defaultOwner returns an owner derived from the hostname of the runner manager, so
+// each runner manager gets its own owner. The owner must be stable across restarts,
+// otherwise the resources of the previous owner leak.
+func defaultOwner() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("could not get hostname: %w", err)
+	}
+
+	owner := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return unicode.ToLower(r)
+		default:
+			return '-'
+		}
+	}, hostname)
+
+	isAlphanumeric := func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+	}
+
+	owner = strings.TrimFunc(owner, func(r rune) bool { return !isAlphanumeric(r) })
+	if len(owner) > 63 {
+		owner = strings.TrimRightFunc(owner[:63], func(r rune) bool { return !isAlphanumeric(r) })
+	}
+	if owner == "" {
+		return "", fmt.Errorf("could not derive owner from hostname: %s", hostname)
+	}
+	return owner, nil
+}
+
 func (g *InstanceGroup) validate() error {
 	errs := []error{}
 
@@ -66,14 +148,212 @@ func (g *InstanceGroup) validate() error {
 		errs = append(errs, fmt.Errorf("invalid plugin config value: volume_size must be >= 10"))
 	}
 
+	if g.VolumeFormat != "" && !slices.Contains(volumeFormats, g.VolumeFormat) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: volume_format must be one of %v", volumeFormats))
+	}
+
+	if g.VolumeMountPath != "" {
+		if !path.IsAbs(g.VolumeMountPath) {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: volume_mount_path must be an absolute path"))
+		}
+		if g.VolumeFormat == "" {
+			errs = append(errs, fmt.Errorf("missing required plugin config: volume_format"))
+		}
+	}
+
+	if (g.VolumeFormat != "" || g.VolumeMountPath != "") && g.VolumeSize == 0 {
+		errs = append(errs, fmt.Errorf("missing required plugin config: volume_size"))
+	}
+
+	if g.VolumePoolSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: volume_pool_size must be >= 0"))
+	} else if g.VolumePoolSize > 0 && g.VolumeSize == 0 && len(g.Volumes) == 0 {
+		errs = append(errs, fmt.Errorf("missing required plugin config: volume_size or volumes"))
+	}
+
+	if g.VolumePoolIdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: volume_pool_idle_timeout must be >= 0"))
+	}
+
+	if g.StandbyPoolSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: standby_pool_size must be >= 0"))
+	}
+
+	if g.StandbyPoolIdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: standby_pool_idle_timeout must be >= 0"))
+	}
+
+	if g.BillingBoundaryMargin < 0 || g.BillingBoundaryMargin >= Duration(time.Hour) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: billing_boundary_margin must be >= 0 and < 1h"))
+	}
+
+	mountPaths := make(map[string]struct{}, len(g.Volumes)+1)
+	if g.VolumeMountPath != "" {
+		mountPaths[path.Clean(g.VolumeMountPath)] = struct{}{}
+	}
+	for i, volume := range g.Volumes {
+		if volume.Size < 10 {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: volumes[%d].size must be >= 10", i))
+		}
+
+		if err := instancegroup.ValidateLabels(volume.Labels); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: volumes[%d].labels: %w", i, err))
+		}
+
+		if volume.Format != "" && !slices.Contains(volumeFormats, volume.Format) {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: volumes[%d].format must be one of %v", i, volumeFormats))
+		}
+
+		if volume.MountPath != "" {
+			if !path.IsAbs(volume.MountPath) {
+				errs = append(errs, fmt.Errorf("invalid plugin config value: volumes[%d].mount_path must be an absolute path", i))
+			}
+			if volume.Format == "" {
+				errs = append(errs, fmt.Errorf("missing required plugin config: volumes[%d].format", i))
+			}
+			if _, ok := mountPaths[path.Clean(volume.MountPath)]; ok {
+				errs = append(errs, fmt.Errorf("invalid plugin config value: volumes[%d].mount_path is already used by another volume", i))
+			}
+			mountPaths[path.Clean(volume.MountPath)] = struct{}{}
+		}
+	}
+
+	if g.PublicIPPoolIPv4Policy != "" && !slices.Contains(instancegroup.IPPoolPolicies, instancegroup.IPPoolPolicy(g.PublicIPPoolIPv4Policy)) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: public_ip_pool_ipv4_policy must be one of %v", instancegroup.IPPoolPolicies))
+	}
+
+	if g.PublicIPPoolIPv6Policy != "" && !slices.Contains(instancegroup.IPPoolPolicies, instancegroup.IPPoolPolicy(g.PublicIPPoolIPv6Policy)) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: public_ip_pool_ipv6_policy must be one of %v", instancegroup.IPPoolPolicies))
+	}
+
+	if g.CreationTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: creation_timeout must be >= 0"))
+	}
+
+	if g.CreationTimeoutPolicy != "" && !slices.Contains(creationTimeoutPolicies, g.CreationTimeoutPolicy) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: creation_timeout_policy must be one of %v", creationTimeoutPolicies))
+	}
+
+	if g.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: shutdown_timeout must be >= 0"))
+	}
+
+	if g.MaxInstanceAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: max_instance_age must be >= 0"))
+	}
+
+	if g.MaxInstanceAgePolicy != "" && !slices.Contains(maxInstanceAgePolicies, g.MaxInstanceAgePolicy) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: max_instance_age_policy must be one of %v", maxInstanceAgePolicies))
+	}
+
+	if g.StaticInstancesDecreasePolicy != "" && !slices.Contains(instancegroup.StaticDecreasePolicies, instancegroup.StaticDecreasePolicy(g.StaticInstancesDecreasePolicy)) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: static_instances_decrease_policy must be one of %v", instancegroup.StaticDecreasePolicies))
+	}
+
+	// The static servers are not created by the plugin, and never have the ssh key
+	// uploaded by the plugin.
+	if g.StaticInstances != "" && !g.settings.UseStaticCredentials {
+		errs = append(errs, fmt.Errorf("missing required config: connector_config.use_static_credentials (required by static_instances)"))
+	}
+
+	for i, preference := range g.AddressPreference {
+		if !slices.Contains(addressPreferences, preference) {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: address_preference[%d] must be one of %v, got %q", i, addressPreferences, preference))
+		} else if slices.Index(g.AddressPreference, preference) != i {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: address_preference[%d] is a duplicate, got %q", i, preference))
+		}
+	}
+
+	if g.InternalNetworkIPRange != "" {
+		if _, _, err := net.ParseCIDR(g.InternalNetworkIPRange); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: internal_network_ip_range: %w", err))
+		}
+	}
+
+	if g.InternalNetworkAliasIPCount < 0 {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: internal_network_alias_ip_count must be >= 0"))
+	} else if g.InternalNetworkAliasIPCount > 0 {
+		if _, err := netip.ParsePrefix(g.InternalNetworkAliasIPRange); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: internal_network_alias_ip_range: %w", err))
+		}
+	}
+
+	// The internal network is matched by name or id against the private networks
+	// during the instance group initialization.
+	if (g.InternalNetwork != "" || g.InternalNetworkIPRange != "" || g.InternalNetworkAliasIPCount > 0) && len(g.PrivateNetworks) == 0 {
+		errs = append(errs, fmt.Errorf("missing required plugin config: private_networks"))
+	}
+
+	// The internal network is attached after the server creation when an ip range or
+	// alias ips are needed, the server must therefore be created with another network.
+	if (g.InternalNetworkIPRange != "" || g.InternalNetworkAliasIPCount > 0) &&
+		g.PublicIPv4Disabled && g.PublicIPv6Disabled &&
+		len(g.PrivateNetworks) == 1 && !instancegroup.IsLabelSelector(g.PrivateNetworks[0]) {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: internal_network_ip_range and internal_network_alias_ip_count require a public ip or another private network"))
+	}
+
+	for i, sshKey := range g.SSHKeys {
+		if sshKey == "" {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: ssh_keys[%d] must not be empty", i))
+		}
+	}
+
+	if err := instancegroup.ValidateLabels(map[string]string{instancegroup.OwnerLabel: g.Owner}); err != nil {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: owner: %w", err))
+	}
+
+	if err := instancegroup.ValidateLabels(g.Labels); err != nil {
+		errs = append(errs, fmt.Errorf("invalid plugin config value: labels: %w", err))
+	}
+
+	if g.NameTemplate != "" {
+		if _, err := instancegroup.NewNameTemplate(g.NameTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: name_template: %w", err))
+		}
+	}
+
+	if g.ReverseDNSTemplate != "" {
+		if _, err := instancegroup.NewTemplate("reverse_dns_template", g.ReverseDNSTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: reverse_dns_template: %w", err))
+		}
+	}
+
 	if g.UserData != "" && g.UserDataFile != "" {
 		errs = append(errs, fmt.Errorf("mutually exclusive plugin config provided: user_data, user_data_file"))
 	}
 
+	if g.UserDataTemplate && g.UserData == "" && g.UserDataFile == "" {
+		errs = append(errs, fmt.Errorf("missing required plugin config: user_data or user_data_file"))
+	}
+
+	if g.UserData != "" {
+		if g.UserDataTemplate {
+			if _, err := instancegroup.NewTemplate("user_data", g.UserData); err != nil {
+				errs = append(errs, fmt.Errorf("invalid plugin config value: user_data: %w", err))
+			}
+		}
+		if _, err := cloudinit.Compose(g.UserData); err != nil {
+			errs = append(errs, fmt.Errorf("invalid plugin config value: user_data: %w", err))
+		}
+	}
+
 	if g.settings.Protocol == provider.ProtocolWinRM {
 		errs = append(errs, fmt.Errorf("unsupported connector config protocol: %s", g.settings.Protocol))
 	}
 
+	if g.SSHKeyPerInstance {
+		if g.settings.UseStaticCredentials {
+			errs = append(errs, fmt.Errorf("mutually exclusive config provided: ssh_key_per_instance, connector_config.use_static_credentials"))
+		}
+		if g.StaticInstances != "" {
+			errs = append(errs, fmt.Errorf("mutually exclusive plugin config provided: ssh_key_per_instance, static_instances"))
+		}
+	}
+
+	if g.SSHHostKeyVerification && g.StaticInstances != "" {
+		errs = append(errs, fmt.Errorf("mutually exclusive plugin config provided: ssh_host_key_verification, static_instances"))
+	}
+
 	return errors.Join(errs...)
 }
 
@@ -84,6 +364,15 @@ func (g *InstanceGroup) populate() error {
 			return fmt.Errorf("failed to read user data file: %w", err)
 		}
 		g.UserData = string(userData)
+
+		if g.UserDataTemplate {
+			if _, err := instancegroup.NewTemplate("user_data_file", g.UserData); err != nil {
+				return fmt.Errorf("invalid plugin config value: user_data_file: %w", err)
+			}
+		}
+		if _, err := cloudinit.Compose(g.UserData); err != nil {
+			return fmt.Errorf("invalid plugin config value: user_data_file: %w", err)
+		}
 	}
 
 	g.labels = map[string]string{
@@ -91,5 +380,25 @@ func (g *InstanceGroup) populate() error {
 	}
 	maps.Copy(g.labels, g.Labels)
 
+	if g.Owner == "" {
+		owner, err := defaultOwner()
+		if err != nil {
+			return fmt.Errorf("missing required plugin config: owner: %w", err)
+		}
+		g.Owner = owner
+	}
+
+	if g.CreationTimeoutPolicy == "" {
+		g.CreationTimeoutPolicy = CreationTimeoutDelete
+	}
+
+	if g.MaxInstanceAgePolicy == "" {
+		g.MaxInstanceAgePolicy = MaxInstanceAgeHeartbeat
+	}
+
+	if g.BillingAwareScaleDown && g.BillingBoundaryMargin == 0 {
+		g.BillingBoundaryMargin = Duration(defaultBillingBoundaryMargin)
+	}
+
 	return nil
 }
@@ -1,9 +1,12 @@
 package hetzner
 
 import (
+	"crypto/rand"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -114,6 +117,448 @@ missing required plugin config: image`, err.Error())
 				assert.Equal(t, "invalid plugin config value: volume_size must be >= 10", err.Error())
 			},
 		},
+		{
+			name: "ip pool policy",
+			group: InstanceGroup{
+				Name:                   "fleeting",
+				Token:                  "dummy",
+				Location:               "hel1",
+				ServerTypes:            []string{"cpx22"},
+				Image:                  "debian-12",
+				PublicIPPoolIPv4Policy: "preferred",
+				PublicIPPoolIPv6Policy: "sometimes",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, "invalid plugin config value: public_ip_pool_ipv6_policy must be one of [required preferred disabled]", err.Error())
+			},
+		},
+		{
+			name: "reverse dns template",
+			group: InstanceGroup{
+				Name:               "fleeting",
+				Token:              "dummy",
+				Location:           "hel1",
+				ServerTypes:        []string{"cpx22"},
+				Image:              "debian-12",
+				ReverseDNSTemplate: "{{ .Unknown }}.ci.example.com",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid plugin config value: reverse_dns_template: ")
+				assert.Contains(t, err.Error(), "can't evaluate field Unknown")
+			},
+		},
+		{
+			name: "user data template",
+			group: InstanceGroup{
+				Name:             "fleeting",
+				Token:            "dummy",
+				Location:         "hel1",
+				ServerTypes:      []string{"cpx22"},
+				Image:            "debian-12",
+				UserData:         "#cloud-config\nhostname: {{ .Name }\n",
+				UserDataTemplate: true,
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid plugin config value: user_data: ")
+			},
+		},
+		{
+			name: "user data without template",
+			group: InstanceGroup{
+				Name:        "fleeting",
+				Token:       "dummy",
+				Location:    "hel1",
+				ServerTypes: []string{"cpx22"},
+				Image:       "debian-12",
+				UserData:    "#cloud-config\nhostname: {{ ds.meta_data.hostname }}\n",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "user data template without user data",
+			group: InstanceGroup{
+				Name:             "fleeting",
+				Token:            "dummy",
+				Location:         "hel1",
+				ServerTypes:      []string{"cpx22"},
+				Image:            "debian-12",
+				UserDataTemplate: true,
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, "missing required plugin config: user_data or user_data_file", err.Error())
+			},
+		},
+		{
+			name: "user data too large",
+			group: InstanceGroup{
+				Name:        "fleeting",
+				Token:       "dummy",
+				Location:    "hel1",
+				ServerTypes: []string{"cpx22"},
+				Image:       "debian-12",
+				UserData:    randomText(48 * 1024),
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "invalid plugin config value: user_data: user data exceeds the maximum size of 32768 bytes: ")
+			},
+		},
+		{
+			name: "volume format and mount path",
+			group: InstanceGroup{
+				Name:            "fleeting",
+				Token:           "dummy",
+				Location:        "hel1",
+				ServerTypes:     []string{"cpx22"},
+				Image:           "debian-12",
+				VolumeFormat:    "btrfs",
+				VolumeMountPath: "var/lib/docker",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: volume_format must be one of [ext4 xfs]
+invalid plugin config value: volume_mount_path must be an absolute path
+missing required plugin config: volume_size`, err.Error())
+			},
+		},
+		{
+			name: "volumes",
+			group: InstanceGroup{
+				Name:            "fleeting",
+				Token:           "dummy",
+				Location:        "hel1",
+				ServerTypes:     []string{"cpx22"},
+				Image:           "debian-12",
+				VolumeSize:      10,
+				VolumeFormat:    "ext4",
+				VolumeMountPath: "/var/lib/docker",
+				Volumes: []VolumeConfig{
+					{Size: 5, Format: "btrfs"},
+					{Size: 10, MountPath: "/var/lib/docker/"},
+				},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: volumes[0].size must be >= 10
+invalid plugin config value: volumes[0].format must be one of [ext4 xfs]
+missing required plugin config: volumes[1].format
+invalid plugin config value: volumes[1].mount_path is already used by another volume`, err.Error())
+			},
+		},
+		{
+			name: "volume pool",
+			group: InstanceGroup{
+				Name:                  "fleeting",
+				Token:                 "dummy",
+				Location:              "hel1",
+				ServerTypes:           []string{"cpx22"},
+				Image:                 "debian-12",
+				VolumePoolSize:        2,
+				VolumePoolIdleTimeout: Duration(-time.Hour),
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `missing required plugin config: volume_size or volumes
+invalid plugin config value: volume_pool_idle_timeout must be >= 0`, err.Error())
+			},
+		},
+		{
+			name: "standby pool",
+			group: InstanceGroup{
+				Name:                   "fleeting",
+				Token:                  "dummy",
+				Location:               "hel1",
+				ServerTypes:            []string{"cpx22"},
+				Image:                  "debian-12",
+				StandbyPoolSize:        -1,
+				StandbyPoolIdleTimeout: Duration(-time.Hour),
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: standby_pool_size must be >= 0
+invalid plugin config value: standby_pool_idle_timeout must be >= 0`, err.Error())
+			},
+		},
+		{
+			name: "ssh keys",
+			group: InstanceGroup{
+				Name:        "fleeting",
+				Token:       "dummy",
+				Location:    "hel1",
+				ServerTypes: []string{"cpx22"},
+				Image:       "debian-12",
+				SSHKeys:     []string{"team=oncall", ""},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: ssh_keys[1] must not be empty`, err.Error())
+			},
+		},
+		{
+			name: "owner",
+			group: InstanceGroup{
+				Name:        "fleeting",
+				Token:       "dummy",
+				Location:    "hel1",
+				ServerTypes: []string{"cpx22"},
+				Image:       "debian-12",
+				Owner:       "manager 1",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: owner: invalid label value: fleeting-owner=manager 1`, err.Error())
+			},
+		},
+		{
+			name: "labels",
+			group: InstanceGroup{
+				Name:        "fleeting",
+				Token:       "dummy",
+				Location:    "hel1",
+				ServerTypes: []string{"cpx22"},
+				Image:       "debian-12",
+				Labels:      map[string]string{"server-type": "{{ .ServerType }}", "key": "{{ .Name }} value"},
+				VolumeSize:  10,
+				Volumes:     []VolumeConfig{{Size: 10, Labels: map[string]string{"key/": "value"}}},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: volumes[0].labels: invalid label key: key/
+invalid plugin config value: labels: invalid label value: key=fleeting-a1b2c3d4 value`, err.Error())
+			},
+		},
+		{
+			name: "static instances",
+			group: InstanceGroup{
+				Name:                          "fleeting",
+				Token:                         "dummy",
+				Location:                      "hel1",
+				ServerTypes:                   []string{"cpx22"},
+				Image:                         "debian-12",
+				StaticInstances:               "runner=static",
+				StaticInstancesDecreasePolicy: "delete",
+				settings: provider.Settings{
+					ConnectorConfig: provider.ConnectorConfig{
+						UseStaticCredentials: true,
+					},
+				},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: static_instances_decrease_policy must be one of [release rebuild]`, err.Error())
+			},
+		},
+		{
+			name: "static instances without static credentials",
+			group: InstanceGroup{
+				Name:            "fleeting",
+				Token:           "dummy",
+				Location:        "hel1",
+				ServerTypes:     []string{"cpx22"},
+				Image:           "debian-12",
+				StaticInstances: "runner=static",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `missing required config: connector_config.use_static_credentials (required by static_instances)`, err.Error())
+			},
+		},
+		{
+			name: "ssh key per instance",
+			group: InstanceGroup{
+				Name:              "fleeting",
+				Token:             "dummy",
+				Location:          "hel1",
+				ServerTypes:       []string{"cpx22"},
+				Image:             "debian-12",
+				StaticInstances:   "runner=static",
+				SSHKeyPerInstance: true,
+				settings: provider.Settings{
+					ConnectorConfig: provider.ConnectorConfig{
+						UseStaticCredentials: true,
+					},
+				},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `mutually exclusive config provided: ssh_key_per_instance, connector_config.use_static_credentials
+mutually exclusive plugin config provided: ssh_key_per_instance, static_instances`, err.Error())
+			},
+		},
+		{
+			name: "ssh host key verification",
+			group: InstanceGroup{
+				Name:                   "fleeting",
+				Token:                  "dummy",
+				Location:               "hel1",
+				ServerTypes:            []string{"cpx22"},
+				Image:                  "debian-12",
+				StaticInstances:        "runner=static",
+				SSHHostKeyVerification: true,
+				settings: provider.Settings{
+					ConnectorConfig: provider.ConnectorConfig{
+						UseStaticCredentials: true,
+					},
+				},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `mutually exclusive plugin config provided: ssh_host_key_verification, static_instances`, err.Error())
+			},
+		},
+		{
+			name: "creation timeout",
+			group: InstanceGroup{
+				Name:                  "fleeting",
+				Token:                 "dummy",
+				Location:              "hel1",
+				ServerTypes:           []string{"cpx22"},
+				Image:                 "debian-12",
+				CreationTimeout:       Duration(-time.Minute),
+				CreationTimeoutPolicy: "keep",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: creation_timeout must be >= 0
+invalid plugin config value: creation_timeout_policy must be one of [delete report]`, err.Error())
+			},
+		},
+		{
+			name: "max instance age",
+			group: InstanceGroup{
+				Name:                 "fleeting",
+				Token:                "dummy",
+				Location:             "hel1",
+				ServerTypes:          []string{"cpx22"},
+				Image:                "debian-12",
+				MaxInstanceAge:       Duration(-time.Hour),
+				MaxInstanceAgePolicy: "delete",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: max_instance_age must be >= 0
+invalid plugin config value: max_instance_age_policy must be one of [heartbeat report]`, err.Error())
+			},
+		},
+		{
+			name: "shutdown timeout",
+			group: InstanceGroup{
+				Name:            "fleeting",
+				Token:           "dummy",
+				Location:        "hel1",
+				ServerTypes:     []string{"cpx22"},
+				Image:           "debian-12",
+				ShutdownTimeout: Duration(-time.Minute),
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: shutdown_timeout must be >= 0`, err.Error())
+			},
+		},
+		{
+			name: "name template",
+			group: InstanceGroup{
+				Name:         "fleeting",
+				Token:        "dummy",
+				Location:     "hel1",
+				ServerTypes:  []string{"cpx22"},
+				Image:        "debian-12",
+				NameTemplate: "{{ .GroupName }}_{{ .Random }}",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: name_template: invalid instance name: fleeting_a1b2c3d4: name must be a valid hostname`, err.Error())
+			},
+		},
+		{
+			name: "billing aware scale down",
+			group: InstanceGroup{
+				Name:                  "fleeting",
+				Token:                 "dummy",
+				Location:              "hel1",
+				ServerTypes:           []string{"cpx22"},
+				Image:                 "debian-12",
+				BillingAwareScaleDown: true,
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "billing boundary margin",
+			group: InstanceGroup{
+				Name:                  "fleeting",
+				Token:                 "dummy",
+				Location:              "hel1",
+				ServerTypes:           []string{"cpx22"},
+				Image:                 "debian-12",
+				BillingAwareScaleDown: true,
+				BillingBoundaryMargin: Duration(time.Hour),
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: billing_boundary_margin must be >= 0 and < 1h`, err.Error())
+			},
+		},
+		{
+			name: "internal network",
+			group: InstanceGroup{
+				Name:                        "fleeting",
+				Token:                       "dummy",
+				Location:                    "hel1",
+				ServerTypes:                 []string{"cpx22"},
+				Image:                       "debian-12",
+				PrivateNetworks:             []string{"network"},
+				InternalNetwork:             "other",
+				InternalNetworkIPRange:      "10.0.1.0",
+				InternalNetworkAliasIPCount: 1,
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: internal_network_ip_range: invalid CIDR address: 10.0.1.0
+invalid plugin config value: internal_network_alias_ip_range: netip.ParsePrefix(""): no '/'`, err.Error())
+			},
+		},
+		{
+			name: "internal network without other network",
+			group: InstanceGroup{
+				Name:                   "fleeting",
+				Token:                  "dummy",
+				Location:               "hel1",
+				ServerTypes:            []string{"cpx22"},
+				Image:                  "debian-12",
+				PublicIPv4Disabled:     true,
+				PublicIPv6Disabled:     true,
+				PrivateNetworks:        []string{"network"},
+				InternalNetworkIPRange: "10.0.1.0/24",
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: internal_network_ip_range and internal_network_alias_ip_count require a public ip or another private network`, err.Error())
+			},
+		},
+		{
+			name: "address preference",
+			group: InstanceGroup{
+				Name:              "fleeting",
+				Token:             "dummy",
+				Location:          "hel1",
+				ServerTypes:       []string{"cpx22"},
+				Image:             "debian-12",
+				AddressPreference: []string{"ipv6", "ipv5", "ipv6"},
+			},
+			assert: func(t *testing.T, group InstanceGroup, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, `invalid plugin config value: address_preference[1] must be one of [ipv4 ipv6 internal], got "ipv5"
+invalid plugin config value: address_preference[2] is a duplicate, got "ipv6"`, err.Error())
+			},
+		},
 	}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
@@ -143,3 +588,26 @@ func TestPopulateUserData(t *testing.T) {
 	require.NoError(t, group.populate())
 	require.Equal(t, "my-user-data", group.UserData)
 }
+
+func TestPopulateDefaults(t *testing.T) {
+	group := InstanceGroup{
+		Name:                  "fleeting",
+		BillingAwareScaleDown: true,
+	}
+
+	require.NoError(t, group.populate())
+	owner, err := defaultOwner()
+	require.NoError(t, err)
+	require.Equal(t, owner, group.Owner)
+	require.Equal(t, Duration(5*time.Minute), group.BillingBoundaryMargin)
+	require.Equal(t, CreationTimeoutDelete, group.CreationTimeoutPolicy)
+	require.Equal(t, MaxInstanceAgeHeartbeat, group.MaxInstanceAgePolicy)
+}
+
+func randomText(size int) string {
+	var b strings.Builder
+	for b.Len() < size {
+		b.WriteString(rand.Text())
+	}
+	return b.String()
+}
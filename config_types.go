@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"reflect"
+	"time"
 )
 
 type LaxStringList []string
@@ -41,3 +42,35 @@ func (o *LaxStringList) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// Duration is a [time.Duration] decoded from a duration string, for example "1h30m".
+type Duration time.Duration
+
+var _ json.Unmarshaler = (*Duration)(nil)
+
+func (o *Duration) UnmarshalJSON(data []byte) error {
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return &json.UnmarshalTypeError{
+			Value: string(data),
+			Type:  reflect.TypeFor[Duration](),
+		}
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+
+	*o = Duration(d)
+
+	return nil
+}
+
+// VolumeConfig defines a volume attached to each instance.
+type VolumeConfig struct {
+	Size      int               `json:"size"`
+	Format    string            `json:"format"`
+	Labels    map[string]string `json:"labels"`
+	MountPath string            `json:"mount_path"`
+}
@@ -3,9 +3,14 @@ package hetzner
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/randutil"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/sshutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
 )
 
 func (g *InstanceGroup) UploadSSHPublicKey(ctx context.Context, pub []byte) (sshKey *hcloud.SSHKey, err error) {
@@ -23,27 +28,58 @@ func (g *InstanceGroup) UploadSSHPublicKey(ctx context.Context, pub []byte) (ssh
 		return sshKey, nil
 	}
 
-	sshKey, _, err = g.client.SSHKey.GetByName(ctx, g.Name)
+	name := g.sshKeyName()
+
+	labels, err := g.sshKeyLabels(name)
 	if err != nil {
-		return nil, fmt.Errorf("could not get ssh key: %w", err)
-	}
-	if sshKey != nil {
-		g.log.Warn("deleting existing ssh key", "name", sshKey.Name, "fingerprint", sshKey.Fingerprint)
-		_, err = g.client.SSHKey.Delete(ctx, sshKey)
-		if err != nil {
-			return nil, fmt.Errorf("could not delete ssh key: %w", err)
-		}
+		return nil, err
 	}
 
-	g.log.Info("uploading ssh key", "name", g.Name, "fingerprint", fingerprint)
+	g.log.Info("uploading ssh key", "name", name, "fingerprint", fingerprint)
 	sshKey, _, err = g.client.SSHKey.Create(ctx, hcloud.SSHKeyCreateOpts{
-		Name:      g.Name,
-		Labels:    g.labels,
+		Name:      name,
+		Labels:    labels,
 		PublicKey: string(pub),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not upload ssh key: %w", err)
 	}
 
+	g.sshKeyUploaded = true
+
 	return sshKey, nil
 }
+
+// sshKeyName returns a unique name for the ssh key, so runner processes sharing an
+// instance group name and owner do not replace each other ssh keys.
+func (g *InstanceGroup) sshKeyName() string {
+	return g.Name + "-" + g.Owner + "-" + randutil.GenerateID()
+}
+
+// sshKeyLabels renders the labels of the ssh key. The ssh key is shared by the
+// instances, the label templates are therefore rendered with the instance group data.
+func (g *InstanceGroup) sshKeyLabels(name string) (map[string]string, error) {
+	data := instancegroup.TemplateData{
+		Name:      name,
+		GroupName: g.Name,
+		Location:  g.Location,
+	}
+	if len(g.ServerTypes) > 0 {
+		data.ServerType = g.ServerTypes[0]
+	}
+
+	labels, err := instancegroup.RenderLabels(g.labels, data)
+	if err != nil {
+		return nil, fmt.Errorf("could not render ssh key labels: %w", err)
+	}
+	labels["instance-group"] = g.Name
+	labels[instancegroup.OwnerLabel] = g.Owner
+	labels[instancegroup.UsedAtLabel] = strconv.FormatInt(time.Now().Unix(), 10)
+	return labels, nil
+}
+
+// isManagedSSHKey reports whether the ssh key was uploaded for the instance group,
+// possibly by another runner process.
+func (g *InstanceGroup) isManagedSSHKey() bool {
+	return g.sshKey != nil && g.sshKey.Labels["instance-group"] == g.Name
+}
@@ -3,8 +3,6 @@ package hetzner
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"testing"
@@ -54,50 +52,10 @@ func TestUploadSSHPublicKey(t *testing.T) {
 			run: func(t *testing.T, ctx context.Context, group *InstanceGroup, server *mockutil.Server) {
 				_, sshKey := sshKeyFixture(t)
 
-				server.Expect([]mockutil.Request{
-					{
-						Method: "GET",
-						Want: func(t *testing.T, r *http.Request) {
-							require.Equal(t, "/ssh_keys?fingerprint="+url.QueryEscape(sshKey.Fingerprint), r.RequestURI)
-						},
-						Status: 200,
-						JSON:   schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{}},
-					},
-					{
-						Method: "GET", Path: "/ssh_keys?name=fleeting",
-						Status: 200,
-						JSON:   schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{}},
-					},
-					{
-						Method: "POST", Path: "/ssh_keys",
-						Want: func(t *testing.T, r *http.Request) {
-							body, err := io.ReadAll(r.Body)
-							require.NoError(t, err)
-
-							publicKey, err := json.Marshal(sshKey.PublicKey)
-							require.NoError(t, err)
-
-							require.JSONEq(t, fmt.Sprintf(`{
-								"name": "fleeting",
-								"public_key": %s
-							}`, publicKey), string(body))
-						},
-						Status: 201,
-						JSON:   schema.SSHKeyCreateResponse{SSHKey: sshKey},
-					},
-				})
-
-				result, err := group.UploadSSHPublicKey(ctx, []byte(sshKey.PublicKey))
-				require.NoError(t, err)
-
-				require.Equal(t, int64(1), result.ID)
-				require.Equal(t, "fleeting", result.Name)
-			},
-		},
-		{
-			name: "new with existing name",
-			run: func(t *testing.T, ctx context.Context, group *InstanceGroup, server *mockutil.Server) {
-				_, sshKey := sshKeyFixture(t)
+				group.labels = map[string]string{
+					"managed-by": "fleeting-plugin-hetzner",
+					"group":      "{{ .GroupName }}",
+				}
 
 				server.Expect([]mockutil.Request{
 					{
@@ -108,28 +66,19 @@ func TestUploadSSHPublicKey(t *testing.T) {
 						Status: 200,
 						JSON:   schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{}},
 					},
-					{
-						Method: "GET", Path: "/ssh_keys?name=fleeting",
-						Status: 200,
-						JSON:   schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{sshKey}},
-					},
-					{
-						Method: "DELETE", Path: "/ssh_keys/1",
-						Status: 204,
-					},
 					{
 						Method: "POST", Path: "/ssh_keys",
 						Want: func(t *testing.T, r *http.Request) {
-							body, err := io.ReadAll(r.Body)
-							require.NoError(t, err)
-
-							publicKey, err := json.Marshal(sshKey.PublicKey)
-							require.NoError(t, err)
-
-							require.JSONEq(t, fmt.Sprintf(`{
-								"name": "fleeting",
-								"public_key": %s
-							}`, publicKey), string(body))
+							var payload schema.SSHKeyCreateRequest
+							require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+
+							require.Regexp(t, `^fleeting-manager-1-[0-9a-f]{8}$`, payload.Name)
+							require.Equal(t, sshKey.PublicKey, payload.PublicKey)
+							require.Equal(t, "fleeting", (*payload.Labels)["instance-group"])
+							require.Equal(t, "manager-1", (*payload.Labels)["fleeting-owner"])
+							require.NotEmpty(t, (*payload.Labels)["fleeting-used-at"])
+							require.Equal(t, "fleeting", (*payload.Labels)["group"])
+							require.Equal(t, "fleeting-plugin-hetzner", (*payload.Labels)["managed-by"])
 						},
 						Status: 201,
 						JSON:   schema.SSHKeyCreateResponse{SSHKey: sshKey},
@@ -141,6 +90,7 @@ func TestUploadSSHPublicKey(t *testing.T) {
 
 				require.Equal(t, int64(1), result.ID)
 				require.Equal(t, "fleeting", result.Name)
+				require.True(t, group.sshKeyUploaded)
 			},
 		},
 	}
@@ -156,6 +106,7 @@ func TestUploadSSHPublicKey(t *testing.T) {
 
 			group := &InstanceGroup{
 				Name:     "fleeting",
+				Owner:    "manager-1",
 				log:      hclog.New(hclog.DefaultOptions),
 				settings: provider.Settings{},
 				group:    mock,
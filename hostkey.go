@@ -0,0 +1,78 @@
+package hetzner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+var errHostKeyMismatch = errors.New("host key mismatch")
+
+// verifyHostKey connects to the ssh server, and checks that it presents the host key.
+// The connection is closed before authenticating.
+func verifyHostKey(ctx context.Context, addr string, hostKey []byte) error {
+	expected, _, _, _, err := ssh.ParseAuthorizedKey(hostKey)
+	if err != nil {
+		return fmt.Errorf("could not parse host key: %w", err)
+	}
+
+	presented, err := getHostKey(ctx, addr, expected.Type())
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(presented.Marshal(), expected.Marshal()) {
+		return fmt.Errorf("%w: got %s, want %s", errHostKeyMismatch, ssh.FingerprintSHA256(presented), ssh.FingerprintSHA256(expected))
+	}
+
+	return nil
+}
+
+// verifyHostKeyFingerprint connects to the ssh server, and checks that it presents the
+// ed25519 host key with the fingerprint (see [instancegroup.HostKeyFingerprint]). It is
+// used when the host key is no longer known, e.g. after a plugin restart.
+func verifyHostKeyFingerprint(ctx context.Context, addr string, fingerprint string) error {
+	presented, err := getHostKey(ctx, addr, ssh.KeyAlgoED25519)
+	if err != nil {
+		return err
+	}
+	if got := instancegroup.HostKeyFingerprint(presented); got != fingerprint {
+		return fmt.Errorf("%w: got %s, want %s", errHostKeyMismatch, got, fingerprint)
+	}
+
+	return nil
+}
+
+// getHostKey connects to the ssh server, and returns its host key of the given type.
+// The connection is closed before authenticating.
+func getHostKey(ctx context.Context, addr string, keyType string) (ssh.PublicKey, error) {
+	conn, err := dialProbe(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var presented ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:              "fleeting",
+		HostKeyAlgorithms: []string{keyType},
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			presented = key
+			return errHostKeyMismatch
+		},
+	}
+
+	// The host key callback always fails to abort the connection once the host key is
+	// received, without trying to authenticate.
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	if presented == nil {
+		return nil, fmt.Errorf("could not get host key: %w", err)
+	}
+
+	return presented, nil
+}
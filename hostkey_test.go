@@ -0,0 +1,114 @@
+package hetzner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/sshutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+// startSSHServer starts an ssh server presenting the host key, that rejects all the
+// authentication attempts.
+func startSSHServer(t *testing.T, privateKey []byte) string {
+	t.Helper()
+
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, _ ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, errors.New("denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _, _, _ = ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestVerifyHostKey(t *testing.T) {
+	ctx := context.Background()
+
+	privateKey, publicKey, err := sshutil.GenerateKeyPair()
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		addr := startSSHServer(t, privateKey)
+
+		err := verifyHostKey(ctx, addr, publicKey)
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		otherPrivateKey, _, err := sshutil.GenerateKeyPair()
+		require.NoError(t, err)
+
+		addr := startSSHServer(t, otherPrivateKey)
+
+		err = verifyHostKey(ctx, addr, publicKey)
+		require.ErrorIs(t, err, errHostKeyMismatch)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		err = verifyHostKey(ctx, addr, publicKey)
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, errHostKeyMismatch)
+	})
+}
+
+func TestVerifyHostKeyFingerprint(t *testing.T) {
+	ctx := context.Background()
+
+	privateKey, publicKey, err := sshutil.GenerateKeyPair()
+	require.NoError(t, err)
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	require.NoError(t, err)
+	fingerprint := instancegroup.HostKeyFingerprint(key)
+
+	t.Run("success", func(t *testing.T) {
+		addr := startSSHServer(t, privateKey)
+
+		err := verifyHostKeyFingerprint(ctx, addr, fingerprint)
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		otherPrivateKey, _, err := sshutil.GenerateKeyPair()
+		require.NoError(t, err)
+
+		addr := startSSHServer(t, otherPrivateKey)
+
+		err = verifyHostKeyFingerprint(ctx, addr, fingerprint)
+		require.ErrorIs(t, err, errHostKeyMismatch)
+	})
+}
@@ -0,0 +1,134 @@
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+)
+
+const (
+	// MaxUserDataSize is the maximum size of the server user data accepted by the API.
+	MaxUserDataSize = 32 * 1024
+
+	// gzipThreshold is the size above which the user data is compressed. The
+	// compressed user data is base64 encoded, which increases its size by a third.
+	gzipThreshold = MaxUserDataSize * 3 / 4
+)
+
+const (
+	ContentTypeCloudConfig = "text/cloud-config"
+	ContentTypeShellScript = "text/x-shellscript"
+
+	// contentTypeNotMultipart lets cloud-init detect the type of the part using its
+	// content, for example "#cloud-config" or "#!".
+	contentTypeNotMultipart = "text/x-not-multipart"
+
+	// mergeType merges the plugin cloud-config parts with the user cloud-config,
+	// instead of replacing the user defined keys.
+	mergeType = "list(append)+dict(no_replace,recurse_list)+str()"
+)
+
+// Part is a user data part generated by the plugin.
+type Part struct {
+	// ContentType of the part, for example [ContentTypeCloudConfig].
+	ContentType string
+	// Filename of the part, only used for debugging purposes.
+	Filename string
+	// Content of the part.
+	Content string
+}
+
+// Compose wraps the user data and the plugin generated parts into a MIME multipart
+// cloud-init document. Without parts, the user data is returned unchanged.
+//
+// When the document nears [MaxUserDataSize], it is compressed using gzip and base64
+// encoded. An error is returned when the document still exceeds [MaxUserDataSize].
+func Compose(userData string, parts ...Part) (string, error) {
+	result := userData
+
+	if len(parts) > 0 {
+		var err error
+		result, err = multipartDocument(userData, parts)
+		if err != nil {
+			return "", fmt.Errorf("could not compose user data: %w", err)
+		}
+	}
+
+	if len(result) > gzipThreshold {
+		compressed, err := compress(result)
+		if err != nil {
+			return "", fmt.Errorf("could not compress user data: %w", err)
+		}
+		if len(compressed) < len(result) {
+			result = compressed
+		}
+	}
+
+	if len(result) > MaxUserDataSize {
+		return "", fmt.Errorf("user data exceeds the maximum size of %d bytes: %d bytes", MaxUserDataSize, len(result))
+	}
+
+	return result, nil
+}
+
+func multipartDocument(userData string, parts []Part) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	if userData != "" {
+		parts = append([]Part{{ContentType: contentTypeNotMultipart, Filename: "user-data", Content: userData}}, parts...)
+	}
+
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", part.ContentType))
+		header.Set("MIME-Version", "1.0")
+		if part.Filename != "" {
+			header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", part.Filename))
+		}
+		if part.ContentType == ContentTypeCloudConfig {
+			header.Set("Merge-Type", mergeType)
+		}
+
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write([]byte(part.Content)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	var document bytes.Buffer
+	fmt.Fprintf(&document, "Content-Type: multipart/mixed; boundary=%q\r\n", writer.Boundary())
+	fmt.Fprintf(&document, "MIME-Version: 1.0\r\n\r\n")
+	document.Write(body.Bytes())
+
+	return document.String(), nil
+}
+
+// compress gzips and base64 encodes the user data. The cloud-init Hetzner Cloud
+// datasource base64 decodes the user data, and cloud-init decompresses it.
+func compress(userData string) (string, error) {
+	var buf bytes.Buffer
+
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := writer.Write([]byte(userData)); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
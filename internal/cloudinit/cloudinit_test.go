@@ -0,0 +1,117 @@
+package cloudinit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompose(t *testing.T) {
+	t.Run("user data only", func(t *testing.T) {
+		result, err := Compose("#cloud-config\n")
+		require.NoError(t, err)
+		require.Equal(t, "#cloud-config\n", result)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		result, err := Compose("#cloud-config\n",
+			Part{ContentType: ContentTypeCloudConfig, Filename: "mounts.cfg", Content: "mounts: []\n"},
+			Part{ContentType: ContentTypeShellScript, Content: "#!/bin/sh\n"},
+		)
+		require.NoError(t, err)
+
+		parts := readMultipart(t, result)
+		require.Len(t, parts, 3)
+
+		require.Equal(t, `text/x-not-multipart; charset="utf-8"`, parts[0].header.Get("Content-Type"))
+		require.Equal(t, "#cloud-config\n", parts[0].content)
+
+		require.Equal(t, `text/cloud-config; charset="utf-8"`, parts[1].header.Get("Content-Type"))
+		require.Equal(t, mergeType, parts[1].header.Get("Merge-Type"))
+		require.Equal(t, `attachment; filename="mounts.cfg"`, parts[1].header.Get("Content-Disposition"))
+		require.Equal(t, "mounts: []\n", parts[1].content)
+
+		require.Equal(t, `text/x-shellscript; charset="utf-8"`, parts[2].header.Get("Content-Type"))
+		require.Empty(t, parts[2].header.Get("Merge-Type"))
+		require.Equal(t, "#!/bin/sh\n", parts[2].content)
+	})
+
+	t.Run("multipart without user data", func(t *testing.T) {
+		result, err := Compose("", Part{ContentType: ContentTypeShellScript, Content: "#!/bin/sh\n"})
+		require.NoError(t, err)
+
+		parts := readMultipart(t, result)
+		require.Len(t, parts, 1)
+		require.Equal(t, "#!/bin/sh\n", parts[0].content)
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		userData := "#cloud-config\n" + strings.Repeat("# comment\n", MaxUserDataSize/10)
+
+		result, err := Compose(userData)
+		require.NoError(t, err)
+		require.Less(t, len(result), MaxUserDataSize)
+
+		compressed, err := base64.StdEncoding.DecodeString(result)
+		require.NoError(t, err)
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		decompressed, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.Equal(t, userData, string(decompressed))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		random := make([]byte, MaxUserDataSize)
+		_, err := rand.Read(random)
+		require.NoError(t, err)
+
+		_, err = Compose(hex.EncodeToString(random))
+		require.ErrorContains(t, err, "user data exceeds the maximum size of 32768 bytes: ")
+	})
+}
+
+type testPart struct {
+	header  textproto.MIMEHeader
+	content string
+}
+
+func readMultipart(t *testing.T, document string) []testPart {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(document))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	result := make([]testPart, 0)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(part)
+		require.NoError(t, err)
+
+		result = append(result, testPart{header: part.Header, content: string(content)})
+	}
+
+	return result
+}
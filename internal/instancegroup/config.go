@@ -1,5 +1,7 @@
 package instancegroup
 
+import "time"
+
 type Config struct {
 	// Location is the Hetzner Cloud "Location" (name or id) to create the server in.
 	// Run `hcloud location list` to list available locations.
@@ -16,29 +18,174 @@ type Config struct {
 	// UserData is the data available to initialization framework that may run after the
 	// server boot.
 	UserData string
+	// UserDataTemplate renders the [Config.UserData] as a template (see [TemplateData])
+	// for each instance.
+	UserDataTemplate bool
 
-	// SSHKeys is a list of Hetzner Cloud "SSH Key" (name or id) to create the server
-	// with. Run `hcloud ssh-key list` to list available ssh-keys.
+	// SSHKeys is a list of Hetzner Cloud "SSH Key" (name, id or label selector) to create
+	// the server with. Run `hcloud ssh-key list` to list available ssh-keys.
 	SSHKeys []string
+	// InstanceSSHKeys generates an ssh key pair for each instance, and injects the
+	// public key using the user data. The private keys are only kept in memory.
+	InstanceSSHKeys bool
+	// InstanceHostKeys generates an ssh host key for each instance, and injects it using
+	// the user data. The public keys are only kept in memory.
+	InstanceHostKeys bool
+	// ManagedSSHKey is the Hetzner Cloud "SSH Key" (name or id) uploaded by the plugin,
+	// it must be one of the [Config.SSHKeys]. The servers reference the key in their
+	// labels, and the unreferenced keys of the instance group are deleted after a grace
+	// period.
+	ManagedSSHKey string
 
 	// PublicIPv4Disabled disables the server public IPv4.
 	PublicIPv4Disabled bool
 	// PublicIPv6Disabled disables the server public IPv6.
 	PublicIPv6Disabled bool
+	// PublicIPv6HostOffset is the offset of the instance public IPv6 address in the
+	// server public IPv6 /64 network. Defaults to 1, e.g. `2001:db8::1`.
+	PublicIPv6HostOffset uint64
 	// PublicIPPoolEnabled enables the public IP pool, which offers a way to have
 	// predictable public IPs attached to new servers during there creations.
 	PublicIPPoolEnabled bool
 	// PublicIPPoolSelector is a label selector (https://docs.hetzner.cloud/reference/cloud#label-selector)
 	// used to filter the IPs when populating the IP pool.
 	PublicIPPoolSelector string
+	// PublicIPPoolIPv4Policy defines how the IP pool is used for the server public IPv4.
+	// Defaults to [IPPoolPolicyRequired].
+	PublicIPPoolIPv4Policy IPPoolPolicy
+	// PublicIPPoolIPv6Policy defines how the IP pool is used for the server public IPv6.
+	// Defaults to [IPPoolPolicyRequired].
+	PublicIPPoolIPv6Policy IPPoolPolicy
 
 	// PrivateNetworks is a list of Hetzner Cloud "Network" (name or id) to attach to
 	// the server. Run `hcloud network list` to list available ssh-keys.
 	PrivateNetworks []string
 
+	// InternalNetwork is the Hetzner Cloud "Network" (name or id) used for the instance
+	// internal address, it must be one of the [Config.PrivateNetworks]. Defaults to the
+	// first private network.
+	InternalNetwork string
+	// InternalNetworkIPRange is the subnet IP range (CIDR) of the internal network, from
+	// which the server IP is allocated.
+	InternalNetworkIPRange string
+	// InternalNetworkAliasIPRange is an IP range (CIDR) of the internal network, from
+	// which the server alias IPs are allocated. The IP range must be dedicated to the
+	// instance group.
+	InternalNetworkAliasIPRange string
+	// InternalNetworkAliasIPCount is the number of alias IPs allocated to the server.
+	InternalNetworkAliasIPCount int
+
 	// VolumeSize is the size in GB of the volume that will be attached to the server.
 	VolumeSize int
+	// VolumeFormat is the filesystem (ext4 or xfs) the volume is formatted with.
+	VolumeFormat string
+	// VolumeMountPath is the path the volume is mounted on in the server.
+	VolumeMountPath string
+	// Volumes is a list of additional volumes that will be attached to the server.
+	Volumes []VolumeConfig
+	// VolumePoolSize is the maximum number of volumes kept in the volume pool for
+	// reuse, instead of being deleted. The volume pool is disabled when 0.
+	VolumePoolSize int
+	// VolumePoolIdleTimeout is the duration after which an unused volume is deleted
+	// from the volume pool. Unused volumes are never deleted when 0.
+	VolumePoolIdleTimeout time.Duration
+
+	// StandbyPoolSize is the maximum number of servers kept in the standby pool for
+	// reuse, instead of being deleted. The standby pool is disabled when 0.
+	StandbyPoolSize int
+	// StandbyPoolIdleTimeout is the duration after which an unused server is deleted
+	// from the standby pool. Unused servers are never deleted when 0.
+	StandbyPoolIdleTimeout time.Duration
+
+	// BillingAwareScaleDown parks the servers of the deleted instances until shortly
+	// before their next billing boundary, instead of deleting them right away.
+	BillingAwareScaleDown bool
+	// BillingBoundaryMargin is the duration before the next billing boundary at which
+	// the parked servers are deleted.
+	BillingBoundaryMargin time.Duration
+
+	// ShutdownTimeout is the maximum duration to wait for the server to shut down
+	// gracefully before deleting it. The servers are deleted right away when 0.
+	ShutdownTimeout time.Duration
+
+	// MaxInstanceAge is the age after which the instances expire, see
+	// [Instance.ExpiresAt]. The expired servers are deleted instead of being moved to
+	// a pool. The instances never expire when 0.
+	MaxInstanceAge time.Duration
+
+	// StaticInstancesSelector is a label selector (https://docs.hetzner.cloud/reference/cloud#label-selector)
+	// used to adopt existing servers into the instance group. The static instances are
+	// never deleted.
+	StaticInstancesSelector string
+	// StaticInstancesDecreasePolicy defines how the static instances are removed from
+	// the instance group. Defaults to [StaticDecreasePolicyRelease].
+	StaticInstancesDecreasePolicy StaticDecreasePolicy
+
+	// NameTemplate is a template (see [NameTemplateData]) used to name the instances.
+	// Defaults to `{{ .GroupName }}-{{ .Random }}`.
+	NameTemplate string
+
+	// ReverseDNSTemplate is a template (see [TemplateData]) used to set the reverse DNS
+	// of the server public IPs, e.g. `{{ .Name }}.ci.example.com`.
+	ReverseDNSTemplate string
+
+	// Owner identifies the runner manager using the instance group. It is stored in the
+	// resources labels, and the resources of other owners are ignored.
+	Owner string
+
+	// Labels is a map of key value pairs to create the server and the other instance
+	// resources with. The values are templates (see [TemplateData]) rendered for each
+	// instance.
+	Labels map[string]string
+}
+
+// IPPoolPolicy defines how the public IP pool is used for an IP family.
+type IPPoolPolicy string
+
+const (
+	// IPPoolPolicyRequired fails the instance creation when no IP is left in the pool.
+	IPPoolPolicyRequired IPPoolPolicy = "required"
+	// IPPoolPolicyPreferred falls back to an auto-assigned IP when no IP is left in the
+	// pool.
+	IPPoolPolicyPreferred IPPoolPolicy = "preferred"
+	// IPPoolPolicyDisabled never uses the pool, the IP is always auto-assigned.
+	IPPoolPolicyDisabled IPPoolPolicy = "disabled"
+)
+
+// IPPoolPolicies lists all the supported [IPPoolPolicy].
+var IPPoolPolicies = []IPPoolPolicy{
+	IPPoolPolicyRequired,
+	IPPoolPolicyPreferred,
+	IPPoolPolicyDisabled,
+}
+
+// StaticDecreasePolicy defines how the static instances are removed from the instance
+// group.
+type StaticDecreasePolicy string
+
+const (
+	// StaticDecreasePolicyRelease releases the static instance server as is.
+	StaticDecreasePolicyRelease StaticDecreasePolicy = "release"
+	// StaticDecreasePolicyRebuild rebuilds the static instance server from the image
+	// before releasing it.
+	StaticDecreasePolicyRebuild StaticDecreasePolicy = "rebuild"
+)
+
+// StaticDecreasePolicies lists all the supported [StaticDecreasePolicy].
+var StaticDecreasePolicies = []StaticDecreasePolicy{
+	StaticDecreasePolicyRelease,
+	StaticDecreasePolicyRebuild,
+}
 
-	// Labels is a map of key value pairs to create the server with.
+// VolumeConfig defines a volume attached to each server.
+type VolumeConfig struct {
+	// Size in GB of the volume.
+	Size int
+	// Format is the filesystem (ext4 or xfs) the volume is formatted with.
+	Format string
+	// Labels are added to the volume labels. The values are templates (see
+	// [TemplateData]) rendered for each instance.
 	Labels map[string]string
+	// MountPath is the path the volume is mounted on in the server.
+	MountPath string
 }
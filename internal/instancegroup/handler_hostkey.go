@@ -0,0 +1,74 @@
+package instancegroup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/sshutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
+)
+
+// HostKeyHandler generates an ssh host key for the instance, and injects it in the
+// instance user data, so the host can be verified before connecting to it.
+type HostKeyHandler struct{}
+
+var _ CreateHandler = (*HostKeyHandler)(nil)
+
+func (h *HostKeyHandler) Create(_ context.Context, group *instanceGroup, instance *Instance) error {
+	if !group.config.InstanceHostKeys {
+		return nil
+	}
+
+	privateKey, publicKey, err := sshutil.GenerateKeyPair()
+	if err != nil {
+		return fmt.Errorf("could not generate instance host key: %w", err)
+	}
+
+	instance.SSHHostKey = publicKey
+	instance.userDataParts = append(instance.userDataParts, hostKeyPart(privateKey, publicKey))
+
+	return nil
+}
+
+// HostKeyFingerprint returns the fingerprint of an ssh host key stored in the server
+// labels, which survives the plugin restarts unlike the host key kept in memory. The
+// fingerprint is the hex encoded SHA-256 of the key, truncated to a valid label value.
+func HostKeyFingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return hex.EncodeToString(sum[:31])
+}
+
+// hostKeyFingerprint returns the fingerprint of an ssh host key in the authorized keys
+// format.
+func hostKeyFingerprint(publicKey []byte) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("could not parse instance host key: %w", err)
+	}
+	return HostKeyFingerprint(key), nil
+}
+
+// hostKeyPart returns a cloud-config part that replaces the host keys of the server
+// with the ed25519 host key.
+func hostKeyPart(privateKey, publicKey []byte) cloudinit.Part {
+	var content strings.Builder
+	content.WriteString("#cloud-config\nssh_deletekeys: true\nssh_genkeytypes: []\nssh_keys:\n")
+	content.WriteString("  ed25519_private: |\n")
+	for line := range strings.Lines(strings.TrimSpace(string(privateKey))) {
+		content.WriteString("    " + line)
+	}
+	content.WriteString("\n")
+	fmt.Fprintf(&content, "  ed25519_public: %s\n", strings.TrimSpace(string(publicKey)))
+
+	return cloudinit.Part{
+		ContentType: cloudinit.ContentTypeCloudConfig,
+		Filename:    "ssh-host-keys.cfg",
+		Content:     content.String(),
+	}
+}
@@ -0,0 +1,84 @@
+package instancegroup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/kit/sshutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
+)
+
+// InstanceSSHKeyHandler generates an ssh key pair for the instance, and injects the
+// public key in the instance user data.
+type InstanceSSHKeyHandler struct{}
+
+var _ CreateHandler = (*InstanceSSHKeyHandler)(nil)
+
+func (h *InstanceSSHKeyHandler) Create(_ context.Context, group *instanceGroup, instance *Instance) error {
+	if !group.config.InstanceSSHKeys {
+		return nil
+	}
+
+	privateKey, publicKey, err := sshutil.GenerateKeyPair()
+	if err != nil {
+		return fmt.Errorf("could not generate instance ssh key: %w", err)
+	}
+
+	instance.SSHPrivateKey = privateKey
+	// Without ssh keys, Hetzner Cloud sets a root password, the password authentication
+	// is disabled so the instance key is the only way in.
+	instance.userDataParts = append(instance.userDataParts, cloudinit.Part{
+		ContentType: cloudinit.ContentTypeCloudConfig,
+		Filename:    "ssh-authorized-keys.cfg",
+		Content:     fmt.Sprintf("#cloud-config\nssh_pwauth: false\nssh_authorized_keys:\n  - %s\n", strings.TrimSpace(string(publicKey))),
+	})
+
+	return nil
+}
+
+// instanceKeys holds the keys generated for an instance server.
+type instanceKeys struct {
+	sshPrivateKey []byte
+	sshHostKey    []byte
+}
+
+// setInstanceKeys stores the keys generated for the instance server.
+func (g *instanceGroup) setInstanceKeys(serverID int64, keys instanceKeys) {
+	g.instanceKeysMu.Lock()
+	defer g.instanceKeysMu.Unlock()
+
+	if g.instanceKeys == nil {
+		g.instanceKeys = make(map[int64]instanceKeys)
+	}
+	g.instanceKeys[serverID] = keys
+}
+
+// getInstanceKeys returns the keys generated for the instance server, if known.
+func (g *instanceGroup) getInstanceKeys(serverID int64) (instanceKeys, bool) {
+	g.instanceKeysMu.Lock()
+	defer g.instanceKeysMu.Unlock()
+
+	keys, ok := g.instanceKeys[serverID]
+	return keys, ok
+}
+
+// deleteInstanceKeys forgets the keys generated for the instance server.
+func (g *instanceGroup) deleteInstanceKeys(serverID int64) {
+	g.instanceKeysMu.Lock()
+	defer g.instanceKeysMu.Unlock()
+
+	delete(g.instanceKeys, serverID)
+}
+
+// isReusable reports whether a pooled server can be reused. With per instance ssh
+// keys or host keys, the keys of the server must be known, which is not the case for
+// the servers created by a previous plugin process.
+func (g *instanceGroup) isReusable(serverID int64) bool {
+	if !g.config.InstanceSSHKeys && !g.config.InstanceHostKeys {
+		return true
+	}
+	_, ok := g.getInstanceKeys(serverID)
+	return ok
+}
@@ -0,0 +1,80 @@
+package instancegroup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestInstanceSSHKeyHandlerCreate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.InstanceSSHKeys = true
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Contains(t, payload.UserData, "ssh_pwauth: false\n")
+					require.Contains(t, payload.UserData, "ssh_authorized_keys:\n  - ssh-ed25519 ")
+					require.Empty(t, payload.SSHKeys)
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &InstanceSSHKeyHandler{}
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		privateKey := instance.SSHPrivateKey
+		require.NotEmpty(t, privateKey)
+		require.Len(t, instance.userDataParts, 1)
+
+		{
+			handler := &ServerHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		assert.Equal(t, privateKey, instance.SSHPrivateKey)
+		keys, ok := group.getInstanceKeys(1)
+		require.True(t, ok)
+		assert.Equal(t, privateKey, keys.sshPrivateKey)
+		assert.True(t, group.isReusable(1))
+		assert.False(t, group.isReusable(2))
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		instance := NewInstance("fleeting-a")
+
+		handler := &InstanceSSHKeyHandler{}
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		assert.Nil(t, instance.SSHPrivateKey)
+		assert.Empty(t, instance.userDataParts)
+		assert.True(t, group.isReusable(2))
+	})
+}
@@ -2,7 +2,12 @@ package instancegroup
 
 import (
 	"context"
+	"errors"
 	"fmt"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/ippool"
 )
 
 // IPPoolHandler updates the instance server create options with IPs from a pool of existing IPs.
@@ -30,7 +35,7 @@ func (h *IPPoolHandler) Create(_ context.Context, group *instanceGroup, instance
 	}
 
 	if !group.config.PublicIPv4Disabled {
-		ipv4, err := group.ipPool.NextIPv4()
+		ipv4, err := h.next(group, instance, "ipv4", group.config.PublicIPPoolIPv4Policy, group.ipPool.NextIPv4)
 		if err != nil {
 			return fmt.Errorf("could not get ipv4 from pool: %w", err)
 		}
@@ -39,7 +44,7 @@ func (h *IPPoolHandler) Create(_ context.Context, group *instanceGroup, instance
 	}
 
 	if !group.config.PublicIPv6Disabled {
-		ipv6, err := group.ipPool.NextIPv6()
+		ipv6, err := h.next(group, instance, "ipv6", group.config.PublicIPPoolIPv6Policy, group.ipPool.NextIPv6)
 		if err != nil {
 			return fmt.Errorf("could not get ipv6 from pool: %w", err)
 		}
@@ -49,3 +54,32 @@ func (h *IPPoolHandler) Create(_ context.Context, group *instanceGroup, instance
 
 	return nil
 }
+
+// next returns the next IP from the pool according to the given policy. A nil IP
+// without error means that the IP will be auto-assigned during the server creation.
+func (h *IPPoolHandler) next(
+	group *instanceGroup,
+	instance *Instance,
+	family string,
+	policy IPPoolPolicy,
+	nextFn func() (*hcloud.PrimaryIP, error),
+) (*hcloud.PrimaryIP, error) {
+	log := group.log.With("instance", instance.Name, "family", family, "policy", policy)
+
+	if policy == IPPoolPolicyDisabled {
+		log.Debug("ip pool disabled, using auto-assigned ip")
+		return nil, nil
+	}
+
+	ip, err := nextFn()
+	if err != nil {
+		if policy == IPPoolPolicyPreferred && errors.Is(err, ippool.ErrEmpty) {
+			log.Warn("ip pool is empty, falling back to auto-assigned ip")
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	log.Debug("using ip from pool", "ip", ip.IP.String(), "id", ip.ID)
+	return ip, nil
+}
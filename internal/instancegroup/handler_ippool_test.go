@@ -84,6 +84,118 @@ func TestIPPoolHandlerCreate(t *testing.T) {
 		assert.Equal(t, int64(2), instance.opts.PublicNet.IPv4.ID)
 	})
 
+	t.Run("preferred fallback", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.PublicIPv4Disabled = false
+		config.PublicIPPoolEnabled = true
+		config.PublicIPPoolSelector = "fleeting"
+		config.PublicIPPoolIPv6Policy = IPPoolPolicyPreferred
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/primary_ips?label_selector=fleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.PrimaryIPListResponse{
+					PrimaryIPs: []schema.PrimaryIP{
+						{
+							ID:           2,
+							Name:         "fleeting-a-ipv4",
+							IP:           "201.55.32.12",
+							Type:         "ipv4",
+							AssigneeID:   nil,
+							AssigneeType: "server",
+							Location:     schema.Location{ID: 3, Name: "hel1"},
+						},
+					},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &IPPoolHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		assert.Nil(t, instance.opts.PublicNet.IPv6)
+		assert.NotNil(t, instance.opts.PublicNet.IPv4)
+		assert.Equal(t, int64(2), instance.opts.PublicNet.IPv4.ID)
+	})
+
+	t.Run("required empty", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.PublicIPPoolEnabled = true
+		config.PublicIPPoolSelector = "fleeting"
+		config.PublicIPPoolIPv6Policy = IPPoolPolicyRequired
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/primary_ips?label_selector=fleeting&page=1&per_page=50",
+				Status: 200,
+				JSON:   schema.PrimaryIPListResponse{},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &IPPoolHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.EqualError(t, handler.Create(ctx, group, instance), "could not get ipv6 from pool: ip pool is empty")
+	})
+
+	t.Run("disabled policy", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.PublicIPPoolEnabled = true
+		config.PublicIPPoolSelector = "fleeting"
+		config.PublicIPPoolIPv6Policy = IPPoolPolicyDisabled
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/primary_ips?label_selector=fleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.PrimaryIPListResponse{
+					PrimaryIPs: []schema.PrimaryIP{
+						{
+							ID:           1,
+							Name:         "fleeting-a-ipv6",
+							IP:           "2a01:4f9:c010:cfde::/64",
+							Type:         "ipv6",
+							AssigneeID:   nil,
+							AssigneeType: "server",
+							Location:     schema.Location{ID: 3, Name: "hel1"},
+						},
+					},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &IPPoolHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		assert.Nil(t, instance.opts.PublicNet.IPv6)
+	})
+
 	t.Run("disabled", func(t *testing.T) {
 		ctx := context.Background()
 		config := DefaultTestConfig
@@ -0,0 +1,133 @@
+package instancegroup
+
+import (
+	"context"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// billingPeriod is the period servers are billed for.
+const billingPeriod = time.Hour
+
+// ParkingHandler parks the servers of the deleted instances until shortly before their
+// next billing boundary, and takes the instance servers from the parked servers.
+type ParkingHandler struct {
+	// parked holds the parked servers that can be taken.
+	parked []*hcloud.Server
+	// servers holds the servers of the instance group by ID.
+	servers map[int64]*hcloud.Server
+}
+
+var _ PreIncreaseHandler = (*ParkingHandler)(nil)
+var _ PreDecreaseHandler = (*ParkingHandler)(nil)
+var _ CreateHandler = (*ParkingHandler)(nil)
+var _ CleanupHandler = (*ParkingHandler)(nil)
+var _ SanityHandler = (*ParkingHandler)(nil)
+
+func (h *ParkingHandler) PreIncrease(ctx context.Context, group *instanceGroup) error {
+	if !group.config.BillingAwareScaleDown {
+		return nil
+	}
+
+	servers, err := listPooledServers(ctx, group, stateParked)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	h.parked = make([]*hcloud.Server, 0, len(servers))
+	for _, server := range servers {
+		// Ignore the servers about to be deleted
+		if h.expired(group, server, now) || !group.isReusable(server.ID) {
+			continue
+		}
+		h.parked = append(h.parked, server)
+	}
+
+	return nil
+}
+
+func (h *ParkingHandler) Create(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	if len(h.parked) == 0 {
+		return nil
+	}
+
+	server := h.parked[0]
+	h.parked = h.parked[1:]
+
+	return takePooledServer(ctx, group, instance, server)
+}
+
+func (h *ParkingHandler) PreDecrease(ctx context.Context, group *instanceGroup) error {
+	if !group.config.BillingAwareScaleDown {
+		return nil
+	}
+
+	servers, err := group.listServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.servers = make(map[int64]*hcloud.Server, len(servers))
+	for _, server := range servers {
+		h.servers[server.ID] = server
+	}
+
+	return nil
+}
+
+func (h *ParkingHandler) Cleanup(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	// Only run during a decrease
+	if h.servers == nil {
+		return nil
+	}
+
+	server, ok := h.servers[instance.ID]
+	if !ok || server.Labels[stateLabel] != "" || group.isExpired(server) {
+		return nil
+	}
+
+	// Delete the servers close to their next billing boundary
+	if h.expired(group, server, time.Now()) {
+		return nil
+	}
+
+	releasePooledServer(ctx, group, instance, server, stateParked)
+
+	return nil
+}
+
+func (h *ParkingHandler) Sanity(ctx context.Context, group *instanceGroup) error {
+	servers, err := listPooledServers(ctx, group, stateParked)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deleted := make([]*hcloud.Server, 0)
+	for _, server := range servers {
+		if group.config.BillingAwareScaleDown && !h.expired(group, server, now) {
+			continue
+		}
+		deleted = append(deleted, server)
+	}
+
+	return deletePooledServers(ctx, group, deleted)
+}
+
+// expired reports whether the server must be deleted, to avoid being billed for the
+// next billing period.
+func (h *ParkingHandler) expired(group *instanceGroup, server *hcloud.Server, now time.Time) bool {
+	return nextBillingBoundary(server.Created, now).Sub(now) <= group.config.BillingBoundaryMargin
+}
+
+// nextBillingBoundary returns the start of the next billing period of a server created
+// at the given time.
+func nextBillingBoundary(created, now time.Time) time.Time {
+	if now.Before(created) {
+		return created.Add(billingPeriod)
+	}
+	periods := now.Sub(created)/billingPeriod + 1
+	return created.Add(periods * billingPeriod)
+}
@@ -0,0 +1,235 @@
+package instancegroup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestNextBillingBoundary(t *testing.T) {
+	created := time.Date(2026, 1, 1, 10, 20, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "first period",
+			now:  created.Add(5 * time.Minute),
+			want: created.Add(time.Hour),
+		},
+		{
+			name: "later period",
+			now:  created.Add(2*time.Hour + 30*time.Minute),
+			want: created.Add(3 * time.Hour),
+		},
+		{
+			name: "on boundary",
+			now:  created.Add(time.Hour),
+			want: created.Add(2 * time.Hour),
+		},
+		{
+			name: "clock skew",
+			now:  created.Add(-time.Minute),
+			want: created.Add(time.Hour),
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.want, nextBillingBoundary(created, testCase.now))
+		})
+	}
+}
+
+func TestParkingHandlerCleanup(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.BillingAwareScaleDown = true
+		config.BillingBoundaryMargin = 5 * time.Minute
+
+		now := time.Now()
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Created: now.Add(-10 * time.Minute), Labels: map[string]string{"instance-group": "fleeting"}},
+						{ID: 2, Name: "fleeting-b", Created: now.Add(-58 * time.Minute), Labels: map[string]string{"instance-group": "fleeting"}},
+					},
+				},
+			},
+			// The parked servers are not rebuilt
+			{
+				Method: "PUT", Path: "/servers/1",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "parked", (*payload.Labels)["fleeting-state"])
+				},
+				Status: 200,
+				JSON: schema.ServerUpdateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+				},
+			},
+		})
+
+		handler := &ParkingHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		require.NoError(t, instance.wait())
+		assert.True(t, instance.recycled)
+
+		// Close to the billing boundary
+		instance = &Instance{Name: "fleeting-b", ID: 2}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("success expired", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.BillingAwareScaleDown = true
+		config.BillingBoundaryMargin = 5 * time.Minute
+		config.MaxInstanceAge = time.Hour
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Created: time.Now().Add(-70 * time.Minute), Labels: map[string]string{"instance-group": "fleeting"}},
+					},
+				},
+			},
+		})
+
+		handler := &ParkingHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		// The expired servers are deleted
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.Nil(t, instance.waitFn)
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		handler := &ParkingHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+}
+
+func TestParkingHandlerCreate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.BillingAwareScaleDown = true
+		config.BillingBoundaryMargin = 5 * time.Minute
+
+		now := time.Now()
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dparked&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-x", Created: now.Add(-58 * time.Minute), Labels: map[string]string{"fleeting-state": "parked"}},
+						{ID: 2, Name: "fleeting-y", Created: now.Add(-10 * time.Minute), Labels: map[string]string{"fleeting-state": "parked"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/servers/2",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a", payload.Name)
+					require.NotEmpty(t, (*payload.Labels)["fleeting-taken-at"])
+					delete(*payload.Labels, "fleeting-taken-at")
+					require.Equal(t, &map[string]string{"instance-group": "fleeting"}, payload.Labels)
+				},
+				Status: 200,
+				JSON: schema.ServerUpdateResponse{
+					Server: schema.Server{ID: 2, Name: "fleeting-a"},
+				},
+			},
+		})
+
+		handler := &ParkingHandler{}
+		require.NoError(t, handler.PreIncrease(ctx, group))
+
+		instance := NewInstance("fleeting-a")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.True(t, instance.recycled)
+		assert.Equal(t, "fleeting-a:2", instance.IID())
+
+		instance = NewInstance("fleeting-b")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+}
+
+func TestParkingHandlerSanity(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.BillingAwareScaleDown = true
+		config.BillingBoundaryMargin = 5 * time.Minute
+
+		now := time.Now()
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dparked&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Created: now.Add(-58 * time.Minute), Labels: map[string]string{"fleeting-state": "parked"}},
+						{ID: 2, Name: "fleeting-b", Created: now.Add(-10 * time.Minute), Labels: map[string]string{"fleeting-state": "parked"}},
+					},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/servers/1",
+				Status: 200,
+				JSON: schema.ServerDeleteResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 101, Status: "success"}},
+				},
+			},
+		})
+
+		handler := &ParkingHandler{}
+		require.NoError(t, handler.Sanity(ctx, group))
+	})
+}
@@ -0,0 +1,67 @@
+package instancegroup
+
+import (
+	"context"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// ReverseDNSHandler sets the reverse DNS of the instance public IPs.
+type ReverseDNSHandler struct{}
+
+var _ CreateHandler = (*ReverseDNSHandler)(nil)
+
+func (h *ReverseDNSHandler) Create(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	if group.reverseDNSTemplate == nil {
+		return nil
+	}
+
+	// The reverse DNS is not required by the instance, the failures are therefore only
+	// logged, instead of deleting an otherwise healthy server.
+	log := group.log.With("instance", instance.Name, "id", instance.ID)
+
+	ptr, err := renderTemplate(group.reverseDNSTemplate, group.templateData(instance))
+	if err != nil {
+		log.Warn("could not render reverse dns", "error", err)
+		return nil
+	}
+
+	ips := make([]string, 0, 2)
+
+	if !instance.Server.PublicNet.IPv4.IsUnspecified() {
+		ips = append(ips, instance.Server.PublicNet.IPv4.IP.String())
+	}
+
+	if !instance.Server.PublicNet.IPv6.IsUnspecified() {
+		ipv6, err := instance.PublicIPv6()
+		if err != nil {
+			log.Warn("could not change reverse dns", "error", err)
+		} else {
+			ips = append(ips, ipv6.String())
+		}
+	}
+
+	actions := make([]*hcloud.Action, 0, len(ips))
+	for _, ip := range ips {
+		action, _, err := group.client.Server.ChangeDNSPtr(ctx, instance.Server, ip, &ptr)
+		if err != nil {
+			log.Warn("could not request reverse dns change", "ip", ip, "error", err)
+			continue
+		}
+		actions = append(actions, action)
+	}
+
+	if len(actions) == 0 {
+		return nil
+	}
+
+	instance.waitFn = func() error {
+		if err := group.client.Action.WaitFor(ctx, actions...); err != nil {
+			log.Warn("could not change reverse dns", "error", err)
+		}
+
+		return nil
+	}
+
+	return nil
+}
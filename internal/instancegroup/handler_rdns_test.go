@@ -0,0 +1,161 @@
+package instancegroup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestReverseDNSHandlerCreate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.ReverseDNSTemplate = "{{ .Name }}.ci.example.com"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers/1/actions/change_dns_ptr",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerActionChangeDNSPtrRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "201.55.32.12", payload.IP)
+					require.Equal(t, "fleeting-a.ci.example.com", *payload.DNSPtr)
+				},
+				Status: 201,
+				JSON: schema.ServerActionChangeDNSPtrResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "POST", Path: "/servers/1/actions/change_dns_ptr",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerActionChangeDNSPtrRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "2a01:4f9:c010:cfde::1", payload.IP)
+					require.Equal(t, "fleeting-a.ci.example.com", *payload.DNSPtr)
+				},
+				Status: 201,
+				JSON: schema.ServerActionChangeDNSPtrResponse{
+					Action: schema.Action{ID: 102, Status: "running"},
+				},
+			},
+		})
+
+		instance := InstanceFromServer(hcloud.ServerFromSchema(schema.Server{
+			ID:   1,
+			Name: "fleeting-a",
+			PublicNet: schema.ServerPublicNet{
+				IPv4: schema.ServerPublicNetIPv4{IP: "201.55.32.12"},
+				IPv6: schema.ServerPublicNetIPv6{IP: "2a01:4f9:c010:cfde::/64"},
+			},
+		}))
+
+		handler := &ReverseDNSHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		assert.NotNil(t, instance.waitFn)
+	})
+
+	t.Run("success with labels", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.Labels = map[string]string{"team": "{{ .GroupName }}"}
+		config.ReverseDNSTemplate = `{{ .Name }}.{{ index .Labels "team" }}.example.com`
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers/1/actions/change_dns_ptr",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerActionChangeDNSPtrRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a.fleeting.example.com", *payload.DNSPtr)
+				},
+				Status: 201,
+				JSON: schema.ServerActionChangeDNSPtrResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := InstanceFromServer(hcloud.ServerFromSchema(schema.Server{
+			ID:     1,
+			Name:   "fleeting-a",
+			Labels: map[string]string{"instance-group": "fleeting", "team": "fleeting"},
+			PublicNet: schema.ServerPublicNet{
+				IPv4: schema.ServerPublicNetIPv4{IP: "201.55.32.12"},
+			},
+		}))
+
+		handler := &ReverseDNSHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+	})
+
+	t.Run("success with failure", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.ReverseDNSTemplate = "{{ .Name }}.ci.example.com"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers/1/actions/change_dns_ptr",
+				Status: 403,
+				JSON: schema.ErrorResponse{
+					Error: schema.Error{Code: "forbidden", Message: "reverse dns is not delegated"},
+				},
+			},
+			{
+				Method: "POST", Path: "/servers/1/actions/change_dns_ptr",
+				Status: 201,
+				JSON: schema.ServerActionChangeDNSPtrResponse{
+					Action: schema.Action{ID: 102, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=102&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 102, Status: "error", Error: &schema.ActionError{Code: "action_failed", Message: "Action failed"}}},
+				},
+			},
+		})
+
+		instance := InstanceFromServer(hcloud.ServerFromSchema(schema.Server{
+			ID:   1,
+			Name: "fleeting-a",
+			PublicNet: schema.ServerPublicNet{
+				IPv4: schema.ServerPublicNetIPv4{IP: "201.55.32.12"},
+				IPv6: schema.ServerPublicNetIPv6{IP: "2a01:4f9:c010:cfde::/64"},
+			},
+		}))
+
+		handler := &ReverseDNSHandler{}
+
+		// The instance is kept
+		require.NoError(t, handler.Create(ctx, group, instance))
+		require.NoError(t, instance.wait())
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+
+		handler := &ReverseDNSHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		assert.Nil(t, instance.waitFn)
+	})
+}
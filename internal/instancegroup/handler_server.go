@@ -3,34 +3,126 @@ package instancegroup
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/netip"
+	"slices"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/actionutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
 )
 
 // ServerHandler creates a server from the instance server create options.
-type ServerHandler struct{}
+type ServerHandler struct {
+	// usedAliasIPs holds the IPs already allocated in the internal network alias IP range.
+	usedAliasIPs map[netip.Addr]struct{}
+}
 
+var _ PreIncreaseHandler = (*ServerHandler)(nil)
 var _ CreateHandler = (*ServerHandler)(nil)
 var _ CleanupHandler = (*ServerHandler)(nil)
 
+func (h *ServerHandler) PreIncrease(ctx context.Context, group *instanceGroup) error {
+	if group.config.InternalNetworkAliasIPCount == 0 {
+		return nil
+	}
+
+	h.usedAliasIPs = make(map[netip.Addr]struct{})
+
+	// Reserve the gateway IPs of the network that fall inside the alias IP range
+	for _, subnet := range group.internalNetwork.Subnets {
+		if addr, ok := netip.AddrFromSlice(subnet.Gateway); ok && group.internalNetworkAliasIPs.Contains(addr.Unmap()) {
+			h.usedAliasIPs[addr.Unmap()] = struct{}{}
+		}
+	}
+
+	servers, err := group.listServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		for _, privateNet := range server.PrivateNet {
+			if privateNet.Network == nil || privateNet.Network.ID != group.internalNetwork.ID {
+				continue
+			}
+
+			for _, ip := range append([]net.IP{privateNet.IP}, privateNet.Aliases...) {
+				if addr, ok := netip.AddrFromSlice(ip); ok {
+					h.usedAliasIPs[addr.Unmap()] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func (h *ServerHandler) Create(ctx context.Context, group *instanceGroup, instance *Instance) error {
 	instance.opts.Name = instance.Name
-	instance.opts.Labels = group.labels
 	instance.opts.Location = group.location
 	instance.opts.Image = group.image
 	instance.opts.SSHKeys = group.sshKeys
-	instance.opts.UserData = group.config.UserData
 	instance.opts.PublicNet.EnableIPv4 = !group.config.PublicIPv4Disabled
 	instance.opts.PublicNet.EnableIPv6 = !group.config.PublicIPv6Disabled
 	instance.opts.Networks = group.privateNetworks
 
+	var attachOpts *hcloud.ServerAttachToNetworkOpts
+	if group.attachInternalNetworkAfterCreate() {
+		aliasIPs, err := h.allocateAliasIPs(group)
+		if err != nil {
+			return err
+		}
+
+		attachOpts = &hcloud.ServerAttachToNetworkOpts{
+			Network:  group.internalNetwork,
+			IPRange:  group.internalNetworkIPRange,
+			AliasIPs: aliasIPs,
+		}
+
+		// The internal network is attached once the server is created.
+		instance.opts.Networks = slices.DeleteFunc(slices.Clone(group.privateNetworks), func(network *hcloud.Network) bool {
+			return network.ID == group.internalNetwork.ID
+		})
+	}
+
+	data := group.templateData(instance)
+	if attachOpts != nil {
+		for i := range data.PrivateNetworks {
+			if data.PrivateNetworks[i].ID != group.internalNetwork.ID {
+				continue
+			}
+			for _, ip := range attachOpts.AliasIPs {
+				data.PrivateNetworks[i].AliasIPs = append(data.PrivateNetworks[i].AliasIPs, ip.String())
+			}
+		}
+	}
+
 	var result hcloud.ServerCreateResult
 	var err error
 
 	for _, serverType := range group.serverTypes {
 		instance.opts.ServerType = serverType
 
+		data.ServerType = serverType.Name
+		instance.opts.Labels, err = group.instanceLabels(data)
+		if err != nil {
+			return err
+		}
+		if instance.SSHHostKey != nil {
+			instance.opts.Labels[hostKeyLabel], err = hostKeyFingerprint(instance.SSHHostKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		data.Labels = instance.opts.Labels
+		instance.opts.UserData, err = h.userData(group, instance, data)
+		if err != nil {
+			return err
+		}
+
 		result, _, err = group.client.Server.Create(ctx, *instance.opts)
 		if err != nil && hcloud.IsError(err, hcloud.ErrorCodeResourceUnavailable) {
 			group.log.Warn("resource unavailable", "server_type", serverType.Name, "err", err)
@@ -42,19 +134,88 @@ func (h *ServerHandler) Create(ctx context.Context, group *instanceGroup, instan
 		return fmt.Errorf("could not request instance creation: %w", err)
 	}
 
-	*instance = *InstanceFromServer(result.Server)
+	if instance.SSHPrivateKey != nil || instance.SSHHostKey != nil {
+		group.setInstanceKeys(result.Server.ID, instanceKeys{
+			sshPrivateKey: instance.SSHPrivateKey,
+			sshHostKey:    instance.SSHHostKey,
+		})
+	}
+
+	*instance = *group.instanceFromServer(result.Server)
 
 	instance.waitFn = func() error {
 		if err := group.client.Action.WaitFor(ctx, actionutil.AppendNext(result.Action, result.NextActions)...); err != nil {
 			return fmt.Errorf("could not create instance: %w", err)
 		}
 
+		if attachOpts != nil {
+			action, _, err := group.client.Server.AttachToNetwork(ctx, result.Server, *attachOpts)
+			if err != nil {
+				return fmt.Errorf("could not request instance network attachment: %w", err)
+			}
+
+			if err := group.client.Action.WaitFor(ctx, action); err != nil {
+				return fmt.Errorf("could not attach instance to network: %w", err)
+			}
+		}
+
 		return nil
 	}
 
 	return nil
 }
 
+// userData renders the user data template and composes it with the instance user data parts.
+func (h *ServerHandler) userData(group *instanceGroup, instance *Instance, data TemplateData) (string, error) {
+	userData := group.config.UserData
+	if group.userDataTemplate != nil {
+		var err error
+		userData, err = renderTemplate(group.userDataTemplate, data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return cloudinit.Compose(userData, instance.userDataParts...)
+}
+
+// allocateAliasIPs returns the next free IPs from the internal network alias IP range.
+func (h *ServerHandler) allocateAliasIPs(group *instanceGroup) ([]net.IP, error) {
+	count := group.config.InternalNetworkAliasIPCount
+	if count == 0 {
+		return nil, nil
+	}
+
+	if h.usedAliasIPs == nil {
+		h.usedAliasIPs = make(map[netip.Addr]struct{})
+	}
+
+	ips := make([]net.IP, 0, count)
+
+	prefix := group.internalNetworkAliasIPs
+
+	// Skip the network address of the range
+	addr := prefix.Addr()
+	if prefix.Bits() < addr.BitLen() {
+		addr = addr.Next()
+	}
+
+	for ; prefix.Contains(addr) && len(ips) < count; addr = addr.Next() {
+		if _, ok := h.usedAliasIPs[addr]; ok {
+			continue
+		}
+
+		h.usedAliasIPs[addr] = struct{}{}
+		ips = append(ips, addr.AsSlice())
+	}
+
+	if len(ips) < count {
+		return nil, fmt.Errorf("no alias ips left in the internal network alias ip range: %s", prefix)
+	}
+
+	return ips, nil
+}
+
 func (h *ServerHandler) Cleanup(ctx context.Context, group *instanceGroup, instance *Instance) error {
 	if instance.ID == 0 {
 		return nil
@@ -64,6 +225,7 @@ func (h *ServerHandler) Cleanup(ctx context.Context, group *instanceGroup, insta
 	if err != nil {
 		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
 			group.log.Warn("tried to delete a server that do not exist", "name", instance.Name, "id", instance.ID)
+			group.deleteInstanceKeys(instance.ID)
 			return nil
 		}
 		return fmt.Errorf("could not request instance deletion: %w", err)
@@ -73,6 +235,7 @@ func (h *ServerHandler) Cleanup(ctx context.Context, group *instanceGroup, insta
 		if err := group.client.Action.WaitFor(ctx, result.Action); err != nil {
 			return fmt.Errorf("could not delete instance: %w", err)
 		}
+		group.deleteInstanceKeys(instance.ID)
 		return nil
 	}
 
@@ -2,15 +2,58 @@ package instancegroup
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
 )
 
+func TestServerHandlerPreIncrease(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultTestConfig
+
+	group := setupInstanceGroup(t, config, []mockutil.Request{
+		{
+			Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+			Status: 200,
+			JSON: schema.ServerListResponse{
+				Servers: []schema.Server{
+					{ID: 1, Name: "fleeting-a", PrivateNet: []schema.ServerPrivateNet{
+						{Network: 1, IP: "10.0.1.2", AliasIPs: []string{"10.0.2.5"}},
+					}},
+				},
+			},
+		},
+	})
+
+	group.internalNetwork = &hcloud.Network{ID: 1, Name: "internal", Subnets: []hcloud.NetworkSubnet{
+		{Gateway: net.ParseIP("10.0.0.1")},
+		{Gateway: net.ParseIP("10.0.2.1")},
+	}}
+	group.internalNetworkAliasIPs = netip.MustParsePrefix("10.0.2.0/24")
+	group.config.InternalNetworkAliasIPCount = 1
+
+	handler := &ServerHandler{}
+	require.NoError(t, handler.PreIncrease(ctx, group))
+
+	// Only the gateways inside the alias ip range are reserved
+	assert.Equal(t, map[netip.Addr]struct{}{
+		netip.MustParseAddr("10.0.2.1"): {},
+		netip.MustParseAddr("10.0.1.2"): {},
+		netip.MustParseAddr("10.0.2.5"): {},
+	}, handler.usedAliasIPs)
+}
+
 func TestServerHandlerCreate(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		ctx := context.Background()
@@ -41,6 +84,167 @@ func TestServerHandlerCreate(t *testing.T) {
 		assert.NotNil(t, instance.ID)
 		assert.NotNil(t, instance.waitFn)
 	})
+	t.Run("success with user data template", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.UserData = "#cloud-config\nhostname: {{ .Name }}\n# {{ .ServerType }} {{ .Architecture }} {{ index .Labels \"instance-group\" }}\n"
+		config.UserDataTemplate = true
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "#cloud-config\nhostname: fleeting-a\n# cpx22 x86 fleeting\n", payload.UserData)
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &ServerHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+	})
+	t.Run("success with untemplated user data", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.UserData = "## template: jinja\n#cloud-config\nhostname: {{ ds.meta_data.hostname }}\n"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, config.UserData, payload.UserData)
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &ServerHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+	})
+	t.Run("success with label templates", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.Labels = map[string]string{"server-type": "{{ .ServerType }}", "key": "value"}
+		config.UserData = "#cloud-config\n# {{ index .Labels \"server-type\" }}\n"
+		config.UserDataTemplate = true
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, &map[string]string{"instance-group": "fleeting", "server-type": "cpx22", "key": "value"}, payload.Labels)
+					require.Equal(t, "#cloud-config\n# cpx22\n", payload.UserData)
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &ServerHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+	})
+	t.Run("success with host key", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.InstanceHostKeys = true
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Len(t, (*payload.Labels)["fleeting-ssh-host-key"], 62)
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		for _, handler := range []CreateHandler{&BaseHandler{}, &HostKeyHandler{}, &ServerHandler{}} {
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+	})
+
+	t.Run("success with user data parts", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.UserData = "#cloud-config\n"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.True(t, strings.HasPrefix(payload.UserData, "Content-Type: multipart/mixed; boundary="))
+					require.Contains(t, payload.UserData, "#cloud-config\n")
+					require.Contains(t, payload.UserData, "mounts: []\n")
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		instance.userDataParts = []cloudinit.Part{
+			{ContentType: cloudinit.ContentTypeCloudConfig, Content: "mounts: []\n"},
+		}
+
+		handler := &ServerHandler{}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+	})
 	t.Run("success with second server type", func(t *testing.T) {
 		ctx := context.Background()
 		config := DefaultTestConfig
@@ -120,6 +324,104 @@ func TestServerHandlerCreate(t *testing.T) {
 			"could not request instance creation: resource unavailable (resource_unavailable)",
 		)
 	})
+	t.Run("success with internal network attachment", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/servers",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, []int64{2}, payload.Networks)
+				},
+				Status: 201,
+				JSON: schema.ServerCreateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 101, Status: "success"}},
+				},
+			},
+			{
+				Method: "POST", Path: "/servers/1/actions/attach_to_network",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerActionAttachToNetworkRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, int64(1), payload.Network)
+					require.Equal(t, "10.0.1.0/24", *payload.IPRange)
+					require.Equal(t, []*string{hcloud.Ptr("10.0.2.2"), hcloud.Ptr("10.0.2.3")}, payload.AliasIPs)
+				},
+				Status: 201,
+				JSON: schema.ServerActionAttachToNetworkResponse{
+					Action: schema.Action{ID: 102, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=102&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 102, Status: "success"}},
+				},
+			},
+		})
+
+		_, ipRange, _ := net.ParseCIDR("10.0.1.0/24")
+		group.privateNetworks = []*hcloud.Network{{ID: 1, Name: "internal"}, {ID: 2, Name: "other"}}
+		group.internalNetwork = group.privateNetworks[0]
+		group.internalNetworkIPRange = ipRange
+		group.internalNetworkAliasIPs = netip.MustParsePrefix("10.0.2.0/30")
+		group.config.InternalNetworkAliasIPCount = 2
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &ServerHandler{usedAliasIPs: map[netip.Addr]struct{}{
+			netip.MustParseAddr("10.0.2.1"): {},
+		}}
+
+		require.NoError(t, handler.Create(ctx, group, instance))
+		require.NoError(t, instance.wait())
+
+		assert.Equal(t, int64(1), instance.ID)
+		assert.Equal(t, int64(1), instance.internalNetworkID)
+	})
+
+	t.Run("failure with no alias ips left", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		group.privateNetworks = []*hcloud.Network{{ID: 1, Name: "internal"}}
+		group.internalNetwork = group.privateNetworks[0]
+		group.internalNetworkAliasIPs = netip.MustParsePrefix("10.0.2.0/31")
+		group.config.InternalNetworkAliasIPCount = 1
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &ServerHandler{usedAliasIPs: map[netip.Addr]struct{}{
+			netip.MustParseAddr("10.0.2.1"): {},
+		}}
+
+		require.EqualError(t,
+			handler.Create(ctx, group, instance),
+			"no alias ips left in the internal network alias ip range: 10.0.2.0/31",
+		)
+	})
 }
 
 func TestServerHandlerCleanup(t *testing.T) {
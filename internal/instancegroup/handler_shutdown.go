@@ -0,0 +1,108 @@
+package instancegroup
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// shutdownPollInterval is the interval between the checks of the server status while
+// waiting for the server to shut down.
+const shutdownPollInterval = time.Second
+
+// ShutdownHandler gracefully shuts down the server of the instance before its
+// deletion, so the services running on the server can stop cleanly. The server is
+// labeled before the shutdown, so it is not mistaken for a server in creation, see
+// [Instance.ShutdownAt].
+type ShutdownHandler struct {
+	// servers holds the servers of the instance group by ID.
+	servers map[int64]*hcloud.Server
+}
+
+var _ PreDecreaseHandler = (*ShutdownHandler)(nil)
+var _ CleanupHandler = (*ShutdownHandler)(nil)
+
+func (h *ShutdownHandler) PreDecrease(ctx context.Context, group *instanceGroup) error {
+	if group.config.ShutdownTimeout == 0 {
+		return nil
+	}
+
+	servers, err := group.listServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.servers = make(map[int64]*hcloud.Server, len(servers))
+	for _, server := range servers {
+		h.servers[server.ID] = server
+	}
+
+	return nil
+}
+
+func (h *ShutdownHandler) Cleanup(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	// Only run during a decrease
+	if h.servers == nil {
+		return nil
+	}
+
+	server, ok := h.servers[instance.ID]
+	if !ok {
+		return nil
+	}
+
+	// The server is deleted regardless of the shutdown outcome, the shutdown errors are
+	// therefore only logged.
+	labels := make(map[string]string, len(server.Labels)+1)
+	maps.Copy(labels, server.Labels)
+	labels[shutdownAtLabel] = strconv.FormatInt(time.Now().Unix(), 10)
+
+	_, _, err := group.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{Labels: labels})
+	if err != nil {
+		if !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			group.log.Warn("could not update server", "name", instance.Name, "id", instance.ID, "error", err)
+		}
+		return nil
+	}
+
+	_, _, err = group.client.Server.Shutdown(ctx, server)
+	if err != nil {
+		if !hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+			group.log.Warn("could not shutdown server", "name", instance.Name, "id", instance.ID, "error", err)
+		}
+		return nil
+	}
+
+	// The deadline is shared by the instances shutting down in parallel.
+	deadline := time.Now().Add(group.config.ShutdownTimeout)
+
+	instance.waitFn = func() error {
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+
+		for {
+			server, _, err := group.client.Server.GetByID(ctx, instance.ID)
+			if err != nil {
+				if ctx.Err() == nil {
+					group.log.Warn("could not get server", "name", instance.Name, "id", instance.ID, "error", err)
+				}
+				return nil
+			}
+			if server == nil || server.Status == hcloud.ServerStatusOff {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				group.log.Warn("server did not shutdown in time", "name", instance.Name, "id", instance.ID)
+				return nil
+			case <-time.After(shutdownPollInterval):
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package instancegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+const (
+	// sshKeyGracePeriod is the duration after its last use during which an unreferenced
+	// ssh key is kept, as another runner process may still use it.
+	sshKeyGracePeriod = time.Hour
+	// sshKeyTouchInterval is the interval at which the last use of the managed ssh key
+	// is updated.
+	sshKeyTouchInterval = 10 * time.Minute
+)
+
+// SSHKeyHandler deletes the ssh keys of the instance group that are no longer used.
+type SSHKeyHandler struct{}
+
+var _ SanityHandler = (*SSHKeyHandler)(nil)
+
+func (h *SSHKeyHandler) Sanity(ctx context.Context, group *instanceGroup) error {
+	sshKeys, err := group.client.SSHKey.AllWithOpts(ctx,
+		hcloud.SSHKeyListOpts{
+			ListOpts: hcloud.ListOpts{
+				LabelSelector: fmt.Sprintf("instance-group=%s", group.name),
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not list ssh keys: %w", err)
+	}
+
+	servers, err := group.listServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]struct{}, len(servers))
+	for _, server := range servers {
+		if value, ok := server.Labels[sshKeyLabel]; ok {
+			referenced[value] = struct{}{}
+		}
+	}
+
+	errs := make([]error, 0)
+	now := time.Now()
+
+	for _, sshKey := range sshKeys {
+		if !group.isOwned(sshKey.Labels) {
+			continue
+		}
+
+		// Keep the ssh key in use, and mark it as used for the other runner processes
+		if sshKey.ID == group.managedSSHKey.ID {
+			if now.Sub(sshKeyUsedAt(sshKey)) < sshKeyTouchInterval {
+				continue
+			}
+
+			labels := make(map[string]string, len(sshKey.Labels)+1)
+			maps.Copy(labels, sshKey.Labels)
+			labels[UsedAtLabel] = strconv.FormatInt(now.Unix(), 10)
+
+			_, _, err := group.client.SSHKey.Update(ctx, sshKey, hcloud.SSHKeyUpdateOpts{Labels: labels})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not update ssh key: %w", err))
+			}
+			continue
+		}
+
+		if _, ok := referenced[strconv.FormatInt(sshKey.ID, 10)]; ok {
+			continue
+		}
+
+		if now.Sub(sshKeyUsedAt(sshKey)) < sshKeyGracePeriod {
+			continue
+		}
+
+		group.log.Info("deleting unused ssh key", "name", sshKey.Name, "id", sshKey.ID)
+		if _, err := group.client.SSHKey.Delete(ctx, sshKey); err != nil {
+			if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("could not delete ssh key: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sshKeyUsedAt returns the time of the last use of the ssh key, which defaults to
+// the ssh key creation time.
+func sshKeyUsedAt(sshKey *hcloud.SSHKey) time.Time {
+	usedAt := sshKey.Created
+	if value, err := strconv.ParseInt(sshKey.Labels[UsedAtLabel], 10, 64); err == nil {
+		if t := time.Unix(value, 0); t.After(usedAt) {
+			usedAt = t
+		}
+	}
+	return usedAt
+}
@@ -0,0 +1,87 @@
+package instancegroup
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestSSHKeyHandlerSanity(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.Owner = "manager-1"
+
+		now := time.Now()
+		old := strconv.FormatInt(now.Add(-2*time.Hour).Unix(), 10)
+		recent := strconv.FormatInt(now.Add(-5*time.Minute).Unix(), 10)
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/ssh_keys?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.SSHKeyListResponse{
+					SSHKeys: []schema.SSHKey{
+						// Managed ssh key, last used a long time ago
+						{ID: 1, Name: "fleeting-manager-1-a", Created: now.Add(-3 * time.Hour),
+							Labels: map[string]string{"fleeting-owner": "manager-1", "fleeting-used-at": old}},
+						// Referenced by a server
+						{ID: 2, Name: "fleeting-manager-1-b", Created: now.Add(-3 * time.Hour),
+							Labels: map[string]string{"fleeting-owner": "manager-1", "fleeting-used-at": old}},
+						// Recently used by another runner process
+						{ID: 3, Name: "fleeting-manager-1-c", Created: now.Add(-3 * time.Hour),
+							Labels: map[string]string{"fleeting-owner": "manager-1", "fleeting-used-at": recent}},
+						// Unused
+						{ID: 4, Name: "fleeting-manager-1-d", Created: now.Add(-3 * time.Hour),
+							Labels: map[string]string{"fleeting-owner": "manager-1", "fleeting-used-at": old}},
+						// Other owner
+						{ID: 5, Name: "fleeting-manager-2-e", Created: now.Add(-3 * time.Hour),
+							Labels: map[string]string{"fleeting-owner": "manager-2", "fleeting-used-at": old}},
+					},
+				},
+			},
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Labels: map[string]string{"fleeting-ssh-key": "2"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/ssh_keys/1",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.SSHKeyUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.NotEqual(t, old, (*payload.Labels)["fleeting-used-at"])
+					require.Equal(t, "manager-1", (*payload.Labels)["fleeting-owner"])
+				},
+				Status: 200,
+				JSON: schema.SSHKeyUpdateResponse{
+					SSHKey: schema.SSHKey{ID: 1},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/ssh_keys/4",
+				Status: 204,
+			},
+		})
+		group.managedSSHKey = &hcloud.SSHKey{ID: 1}
+
+		labels, err := group.instanceLabels(group.templateData(NewInstance("fleeting-b")))
+		require.NoError(t, err)
+		require.Equal(t, "1", labels["fleeting-ssh-key"])
+
+		handler := &SSHKeyHandler{}
+		require.NoError(t, handler.Sanity(ctx, group))
+	})
+}
@@ -0,0 +1,119 @@
+package instancegroup
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// StandbyHandler takes the instance servers from the standby pool, and moves the
+// servers of the deleted instances to the standby pool after rebuilding them.
+type StandbyHandler struct {
+	// standby holds the servers available in the standby pool.
+	standby []*hcloud.Server
+	// servers holds the servers of the instance group by ID.
+	servers map[int64]*hcloud.Server
+	// pooled is the number of servers in the standby pool.
+	pooled int
+}
+
+var _ PreIncreaseHandler = (*StandbyHandler)(nil)
+var _ PreDecreaseHandler = (*StandbyHandler)(nil)
+var _ CreateHandler = (*StandbyHandler)(nil)
+var _ CleanupHandler = (*StandbyHandler)(nil)
+var _ SanityHandler = (*StandbyHandler)(nil)
+
+func (h *StandbyHandler) PreIncrease(ctx context.Context, group *instanceGroup) error {
+	if group.config.StandbyPoolSize == 0 {
+		return nil
+	}
+
+	servers, err := listPooledServers(ctx, group, stateStandby)
+	if err != nil {
+		return err
+	}
+
+	h.standby = slices.DeleteFunc(servers, func(server *hcloud.Server) bool {
+		return !group.isReusable(server.ID)
+	})
+
+	return nil
+}
+
+func (h *StandbyHandler) Create(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	if len(h.standby) == 0 {
+		return nil
+	}
+
+	server := h.standby[0]
+	h.standby = h.standby[1:]
+
+	return takePooledServer(ctx, group, instance, server)
+}
+
+func (h *StandbyHandler) PreDecrease(ctx context.Context, group *instanceGroup) error {
+	if group.config.StandbyPoolSize == 0 {
+		return nil
+	}
+
+	servers, err := group.listServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.servers = make(map[int64]*hcloud.Server, len(servers))
+	h.pooled = 0
+	for _, server := range servers {
+		h.servers[server.ID] = server
+		if server.Labels[stateLabel] == stateStandby {
+			h.pooled++
+		}
+	}
+
+	return nil
+}
+
+func (h *StandbyHandler) Cleanup(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	// Only run during a decrease
+	if h.servers == nil || h.pooled >= group.config.StandbyPoolSize {
+		return nil
+	}
+
+	server, ok := h.servers[instance.ID]
+	if !ok || server.Labels[stateLabel] != "" || group.isExpired(server) {
+		return nil
+	}
+
+	if releasePooledServer(ctx, group, instance, server, stateStandby) {
+		h.pooled++
+	}
+
+	return nil
+}
+
+func (h *StandbyHandler) Sanity(ctx context.Context, group *instanceGroup) error {
+	servers, err := listPooledServers(ctx, group, stateStandby)
+	if err != nil {
+		return err
+	}
+
+	// Keep the most recently released servers
+	slices.SortFunc(servers, func(a, b *hcloud.Server) int {
+		return releasedAt(b.Labels).Compare(releasedAt(a.Labels))
+	})
+
+	deleted := make([]*hcloud.Server, 0)
+	for i, server := range servers {
+		expired := group.config.StandbyPoolIdleTimeout > 0 &&
+			time.Since(releasedAt(server.Labels)) > group.config.StandbyPoolIdleTimeout
+
+		if !expired && i < group.config.StandbyPoolSize {
+			continue
+		}
+		deleted = append(deleted, server)
+	}
+
+	return deletePooledServers(ctx, group, deleted)
+}
@@ -0,0 +1,339 @@
+package instancegroup
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestStandbyHandlerCreate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 2
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dstandby&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-x", Labels: map[string]string{
+							"instance-group": "fleeting", "fleeting-state": "standby", "fleeting-released-at": "1700000000",
+						}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/servers/1",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a", payload.Name)
+					require.NotEmpty(t, (*payload.Labels)["fleeting-taken-at"])
+					delete(*payload.Labels, "fleeting-taken-at")
+					require.Equal(t, &map[string]string{"instance-group": "fleeting"}, payload.Labels)
+				},
+				Status: 200,
+				JSON: schema.ServerUpdateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a", Labels: map[string]string{"instance-group": "fleeting"}},
+				},
+			},
+		})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreIncrease(ctx, group))
+
+		instance := NewInstance("fleeting-a")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.True(t, instance.recycled)
+		assert.Equal(t, "fleeting-a:1", instance.IID())
+
+		// The standby pool is empty
+		instance = NewInstance("fleeting-b")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("success with reverse dns", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 1
+		config.ReverseDNSTemplate = "{{ .Name }}.ci.example.com"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dstandby&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-x", Labels: map[string]string{"instance-group": "fleeting", "fleeting-state": "standby"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/servers/1",
+				Status: 200,
+				JSON: schema.ServerUpdateResponse{
+					Server: schema.Server{
+						ID: 1, Name: "fleeting-a", Labels: map[string]string{"instance-group": "fleeting"},
+						PublicNet: schema.ServerPublicNet{
+							IPv4: schema.ServerPublicNetIPv4{IP: "201.55.32.12"},
+						},
+					},
+				},
+			},
+			{
+				Method: "POST", Path: "/servers/1/actions/change_dns_ptr",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerActionChangeDNSPtrRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "201.55.32.12", payload.IP)
+					require.Equal(t, "fleeting-a.ci.example.com", *payload.DNSPtr)
+				},
+				Status: 201,
+				JSON: schema.ServerActionChangeDNSPtrResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 101, Status: "success"}},
+				},
+			},
+		})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreIncrease(ctx, group))
+
+		instance := NewInstance("fleeting-a")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		require.NoError(t, instance.wait())
+		assert.True(t, instance.recycled)
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreIncrease(ctx, group))
+
+		instance := NewInstance("fleeting-a")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+}
+
+func TestStandbyHandlerCleanup(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 1
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Labels: map[string]string{"instance-group": "fleeting"}},
+						{ID: 2, Name: "fleeting-b", Labels: map[string]string{"instance-group": "fleeting"}},
+					},
+				},
+			},
+			{
+				Method: "POST", Path: "/servers/1/actions/rebuild",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerActionRebuildRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, int64(114690387), payload.Image.ID)
+				},
+				Status: 201,
+				JSON: schema.ServerActionRebuildResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 101, Status: "success"}},
+				},
+			},
+			{
+				Method: "PUT", Path: "/servers/1",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "standby", (*payload.Labels)["fleeting-state"])
+					require.NotEmpty(t, (*payload.Labels)["fleeting-released-at"])
+				},
+				Status: 200,
+				JSON: schema.ServerUpdateResponse{
+					Server: schema.Server{ID: 1, Name: "fleeting-a"},
+				},
+			},
+		})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		require.NoError(t, instance.wait())
+		assert.True(t, instance.recycled)
+
+		// The standby pool is full
+		instance = &Instance{Name: "fleeting-b", ID: 2}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.Nil(t, instance.waitFn)
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("success expired", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 1
+		config.MaxInstanceAge = time.Hour
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Created: time.Now().Add(-2 * time.Hour), Labels: map[string]string{"instance-group": "fleeting"}},
+					},
+				},
+			},
+		})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		// The expired servers are deleted
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.Nil(t, instance.waitFn)
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("success rebuild failure", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 1
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Labels: map[string]string{"instance-group": "fleeting"}},
+					},
+				},
+			},
+			{
+				Method: "POST", Path: "/servers/1/actions/rebuild",
+				Status: 201,
+				JSON: schema.ServerActionRebuildResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 101, Status: "error", Error: &schema.ActionError{Code: "action_failed", Message: "Action failed"}}},
+				},
+			},
+		})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		require.NoError(t, instance.wait())
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.PreDecrease(ctx, group))
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+}
+
+func TestStandbyHandlerSanity(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 1
+		config.StandbyPoolIdleTimeout = time.Hour
+
+		now := time.Now()
+		releasedAt := func(d time.Duration) string {
+			return strconv.FormatInt(now.Add(-d).Unix(), 10)
+		}
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dstandby&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "fleeting-a", Labels: map[string]string{"fleeting-state": "standby", "fleeting-released-at": releasedAt(2 * time.Minute)}},
+						{ID: 2, Name: "fleeting-b", Labels: map[string]string{"fleeting-state": "standby", "fleeting-released-at": releasedAt(time.Minute)}},
+						{ID: 3, Name: "fleeting-c", Labels: map[string]string{"fleeting-state": "standby", "fleeting-released-at": releasedAt(2 * time.Hour)}},
+					},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/servers/1",
+				Status: 200,
+				JSON: schema.ServerDeleteResponse{
+					Action: schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/servers/3",
+				Status: 200,
+				JSON: schema.ServerDeleteResponse{
+					Action: schema.Action{ID: 103, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&id=103&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{{ID: 101, Status: "success"}, {ID: 103, Status: "success"}},
+				},
+			},
+		})
+
+		handler := &StandbyHandler{}
+		require.NoError(t, handler.Sanity(ctx, group))
+	})
+}
@@ -3,15 +3,27 @@ package instancegroup
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/actionutil"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
 )
 
-// VolumeHandler creates a volume and updates the instance server create options with
-// the created volume.
+// VolumeHandler creates the volumes, or reuses volumes from the volume pool, and
+// updates the instance server create options with the volumes.
 type VolumeHandler struct {
-	volumes map[string]*hcloud.Volume
+	volumes []*hcloud.Volume
+
+	// available holds the volumes available in the volume pool.
+	available []*hcloud.Volume
+	// pooled is the number of volumes in the volume pool.
+	pooled int
 }
 
 var _ PreIncreaseHandler = (*VolumeHandler)(nil)
@@ -19,37 +31,114 @@ var _ PreDecreaseHandler = (*VolumeHandler)(nil)
 var _ CreateHandler = (*VolumeHandler)(nil)
 var _ CleanupHandler = (*VolumeHandler)(nil)
 
-func (h *VolumeHandler) PreIncrease(_ context.Context, _ *instanceGroup) error {
-	h.volumes = make(map[string]*hcloud.Volume)
+func (h *VolumeHandler) PreIncrease(ctx context.Context, group *instanceGroup) error {
+	h.volumes = make([]*hcloud.Volume, 0)
+	h.available = nil
+	h.pooled = 0
+
+	if group.config.VolumePoolSize == 0 {
+		return nil
+	}
+
+	volumes, err := group.client.Volume.AllWithOpts(ctx,
+		hcloud.VolumeListOpts{
+			ListOpts: hcloud.ListOpts{
+				LabelSelector: fmt.Sprintf("instance-group=%s,%s=%s", group.name, stateLabel, stateAvailable),
+			},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not list volumes: %w", err)
+	}
+	volumes = group.ownedVolumes(volumes)
+
+	h.available = volumes
+	h.pooled = len(volumes)
 
 	return nil
 }
 
 func (h *VolumeHandler) Create(ctx context.Context, group *instanceGroup, instance *Instance) error {
-	if group.config.VolumeSize == 0 {
+	if len(group.volumes) == 0 {
 		return nil
 	}
 
-	// Create a volume
-	result, _, err := group.client.Volume.Create(ctx, hcloud.VolumeCreateOpts{
-		Name:     instance.Name,
-		Size:     group.config.VolumeSize,
-		Location: group.location,
-		Labels:   group.labels,
-	})
+	data := group.templateData(instance)
+	instanceLabels, err := group.instanceLabels(data)
 	if err != nil {
-		return fmt.Errorf("could not request volume creation: %w", err)
+		return err
 	}
+	data.Labels = instanceLabels
+
+	actions := make([]*hcloud.Action, 0, len(group.volumes))
+	mounts := make([]volumeMount, 0, len(group.volumes))
+
+	for i, config := range group.volumes {
+		labels, err := renderLabels(group.volumeLabelTemplates[i], data)
+		if err != nil {
+			return err
+		}
+		maps.Copy(labels, instanceLabels)
+		labels[instanceLabel] = instance.Name
+		labels[volumeLabel] = strconv.Itoa(i)
+
+		// Reuse a volume from the volume pool
+		if volume := h.acquire(group, i, config); volume != nil {
+			volume, _, err := group.client.Volume.Update(ctx, volume, hcloud.VolumeUpdateOpts{
+				Name:   volumeName(instance, i),
+				Labels: labels,
+			})
+			if err != nil {
+				return fmt.Errorf("could not update volume: %w", err)
+			}
+			group.log.Debug("reusing volume from pool", "instance", instance.Name, "volume", volume.Name, "id", volume.ID)
+
+			instance.opts.Volumes = append(instance.opts.Volumes, volume)
+			h.volumes = append(h.volumes, volume)
+
+			if config.MountPath != "" {
+				mounts = append(mounts, volumeMount{volume: volume, path: config.MountPath})
+			}
+			continue
+		}
 
-	// Add volume to server creation opts
-	instance.opts.Volumes = append(instance.opts.Volumes, result.Volume)
+		opts := hcloud.VolumeCreateOpts{
+			Name:     volumeName(instance, i),
+			Size:     config.Size,
+			Location: group.location,
+			Labels:   labels,
+		}
+		if config.Format != "" {
+			opts.Format = hcloud.Ptr(config.Format)
+		}
+
+		// Create a volume
+		result, _, err := group.client.Volume.Create(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("could not request volume creation: %w", err)
+		}
+
+		// Add volume to server creation opts
+		instance.opts.Volumes = append(instance.opts.Volumes, result.Volume)
+
+		// Save volume for potential cleanup
+		h.volumes = append(h.volumes, result.Volume)
 
-	// Save volume for potential cleanup
-	h.volumes[instance.Name] = result.Volume
+		actions = append(actions, actionutil.AppendNext(result.Action, result.NextActions)...)
+
+		if config.MountPath != "" {
+			mounts = append(mounts, volumeMount{volume: result.Volume, path: config.MountPath})
+		}
+	}
+
+	// Mount the volumes during the server boot
+	if len(mounts) > 0 {
+		instance.userDataParts = append(instance.userDataParts, volumeMountPart(mounts))
+	}
 
 	instance.waitFn = func() error {
-		// Wait for the volume to be created
-		if err := group.client.Action.WaitFor(ctx, actionutil.AppendNext(result.Action, result.NextActions)...); err != nil {
+		// Wait for the volumes to be created
+		if err := group.client.Action.WaitFor(ctx, actions...); err != nil {
 			return fmt.Errorf("could not create volume: %w", err)
 		}
 
@@ -59,9 +148,84 @@ func (h *VolumeHandler) Create(ctx context.Context, group *instanceGroup, instan
 	return nil
 }
 
-func (h *VolumeHandler) PreDecrease(ctx context.Context, group *instanceGroup) error {
-	h.volumes = make(map[string]*hcloud.Volume)
+// acquire removes and returns a volume created with the nth volume config from the
+// available volumes, or nil if none matches.
+func (h *VolumeHandler) acquire(group *instanceGroup, index int, config VolumeConfig) *hcloud.Volume {
+	for i, volume := range h.available {
+		if volumeIndex(volume) != index ||
+			volume.Server != nil ||
+			volume.Size != config.Size ||
+			volume.Location == nil || volume.Location.Name != group.location.Name {
+			continue
+		}
+		if config.Format != "" && (volume.Format == nil || *volume.Format != config.Format) {
+			continue
+		}
 
+		h.available = slices.Delete(h.available, i, i+1)
+		h.pooled--
+		return volume
+	}
+	return nil
+}
+
+// volumeName returns the name of the nth volume of an instance. The first volume is
+// named after the instance.
+func volumeName(instance *Instance, index int) string {
+	if index == 0 {
+		return instance.Name
+	}
+	return fmt.Sprintf("%s-%d", instance.Name, index)
+}
+
+// volumeIndex returns the index of the volume config the volume was created with.
+// Volumes created before the volume label were created with the first volume config.
+func volumeIndex(volume *hcloud.Volume) int {
+	index, err := strconv.Atoi(volume.Labels[volumeLabel])
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// isInstanceVolume returns whether the volume is attached to the instance server, or
+// was created for the instance.
+func isInstanceVolume(volume *hcloud.Volume, instance *Instance) bool {
+	if instance.ID != 0 && volume.Server != nil && volume.Server.ID == instance.ID {
+		return true
+	}
+
+	if name, ok := volume.Labels[instanceLabel]; ok {
+		return name == instance.Name
+	}
+
+	// Volumes created before the instance label are named after the instance.
+	return volume.Name == instance.Name
+}
+
+type volumeMount struct {
+	volume *hcloud.Volume
+	path   string
+}
+
+// volumeMountPart returns a cloud-config part that mounts the volumes using their
+// stable disk ID.
+func volumeMountPart(mounts []volumeMount) cloudinit.Part {
+	var content strings.Builder
+	content.WriteString("#cloud-config\nmounts:\n")
+	for _, mount := range mounts {
+		device := fmt.Sprintf("/dev/disk/by-id/scsi-0HC_Volume_%d", mount.volume.ID)
+		fmt.Fprintf(&content, "  - [%q, %q, \"auto\", \"defaults,nofail,discard\", \"0\", \"2\"]\n", device, mount.path)
+	}
+
+	return cloudinit.Part{
+		ContentType: cloudinit.ContentTypeCloudConfig,
+		Filename:    "volume-mounts.cfg",
+		Content:     content.String(),
+	}
+}
+
+func (h *VolumeHandler) PreDecrease(ctx context.Context, group *instanceGroup) error {
 	volumes, err := group.client.Volume.AllWithOpts(ctx,
 		hcloud.VolumeListOpts{
 			ListOpts: hcloud.ListOpts{
@@ -72,32 +236,70 @@ func (h *VolumeHandler) PreDecrease(ctx context.Context, group *instanceGroup) e
 	if err != nil {
 		return fmt.Errorf("could not list volumes: %w", err)
 	}
+	volumes = group.ownedVolumes(volumes)
 
+	h.volumes = volumes
+	h.pooled = 0
 	for _, volume := range volumes {
-		h.volumes[volume.Name] = volume
+		if isPooledVolume(volume) {
+			h.pooled++
+		}
 	}
 
 	return nil
 }
 
 func (h *VolumeHandler) Cleanup(ctx context.Context, group *instanceGroup, instance *Instance) error {
-	volume, ok := h.volumes[instance.Name]
-	if !ok {
-		return nil
+	for _, volume := range h.volumes {
+		if isPooledVolume(volume) || !isInstanceVolume(volume, instance) {
+			continue
+		}
+
+		// The server is deleted before the volumes, which detaches them.
+		if h.pooled < group.config.VolumePoolSize {
+			if err := h.release(ctx, group, volume); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err := group.client.Volume.Delete(ctx, volume)
+		if err != nil {
+			if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
+				group.log.Warn("tried to delete a volume that do not exist", "name", volume.Name, "id", volume.ID)
+				continue
+			}
+			return fmt.Errorf("could not request volume deletion: %w", err)
+		}
 	}
 
-	_, err := group.client.Volume.Delete(ctx, volume)
+	return nil
+}
+
+// release relabels the volume as available in the volume pool.
+func (h *VolumeHandler) release(ctx context.Context, group *instanceGroup, volume *hcloud.Volume) error {
+	labels := releasedLabels(volume.Labels, stateAvailable)
+	delete(labels, instanceLabel)
+
+	_, _, err := group.client.Volume.Update(ctx, volume, hcloud.VolumeUpdateOpts{Labels: labels})
 	if err != nil {
 		if hcloud.IsError(err, hcloud.ErrorCodeNotFound) {
-			group.log.Warn("tried to delete a volume that do not exist", "name", volume.Name, "id", volume.ID)
+			group.log.Warn("tried to release a volume that do not exist", "name", volume.Name, "id", volume.ID)
 			return nil
 		}
-		return fmt.Errorf("could not request volume deletion: %w", err)
+		return fmt.Errorf("could not update volume: %w", err)
 	}
+	group.log.Debug("released volume to pool", "volume", volume.Name, "id", volume.ID)
+
+	h.pooled++
 
 	return nil
 }
 
+func isPooledVolume(volume *hcloud.Volume) bool {
+	return volume.Labels[stateLabel] == stateAvailable
+}
+
 func (h *VolumeHandler) Sanity(ctx context.Context, group *instanceGroup) error {
 	volumes, err := group.client.Volume.AllWithOpts(ctx,
 		hcloud.VolumeListOpts{
@@ -109,12 +311,20 @@ func (h *VolumeHandler) Sanity(ctx context.Context, group *instanceGroup) error
 	if err != nil {
 		return fmt.Errorf("could not list volumes: %w", err)
 	}
+	volumes = group.ownedVolumes(volumes)
+
+	pooled := make([]*hcloud.Volume, 0)
 
 	for _, volume := range volumes {
 		if volume.Server != nil {
 			continue
 		}
 
+		if isPooledVolume(volume) && group.config.VolumePoolSize > 0 {
+			pooled = append(pooled, volume)
+			continue
+		}
+
 		group.log.Warn("deleting dangling volume", "name", volume.Name, "id", volume.ID)
 		_, err := group.client.Volume.Delete(ctx, volume)
 		if err != nil {
@@ -122,5 +332,25 @@ func (h *VolumeHandler) Sanity(ctx context.Context, group *instanceGroup) error
 		}
 	}
 
+	// Keep the most recently released volumes
+	slices.SortFunc(pooled, func(a, b *hcloud.Volume) int {
+		return releasedAt(b.Labels).Compare(releasedAt(a.Labels))
+	})
+
+	for i, volume := range pooled {
+		expired := group.config.VolumePoolIdleTimeout > 0 &&
+			time.Since(releasedAt(volume.Labels)) > group.config.VolumePoolIdleTimeout
+
+		if !expired && i < group.config.VolumePoolSize {
+			continue
+		}
+
+		group.log.Info("deleting pooled volume", "name", volume.Name, "id", volume.ID, "expired", expired)
+		_, err := group.client.Volume.Delete(ctx, volume)
+		if err != nil {
+			return fmt.Errorf("could not request volume deletion: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -3,13 +3,18 @@ package instancegroup
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
 	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
 )
 
 func TestVolumeHandlerCreate(t *testing.T) {
@@ -28,7 +33,7 @@ func TestVolumeHandlerCreate(t *testing.T) {
 					mustUnmarshal(t, r.Body, &payload)
 					require.Equal(t, "fleeting-a", payload.Name)
 					require.Equal(t, 10, payload.Size)
-					require.Equal(t, &map[string]string{"instance-group": "fleeting"}, payload.Labels)
+					require.Equal(t, &map[string]string{"instance-group": "fleeting", "fleeting-instance": "fleeting-a", "fleeting-volume": "0"}, payload.Labels)
 				},
 				Status: 201,
 				JSON: schema.VolumeCreateResponse{
@@ -51,12 +56,294 @@ func TestVolumeHandlerCreate(t *testing.T) {
 
 		assert.NotNil(t, instance.waitFn)
 
-		assert.Equal(t, instance.Name, handler.volumes[instance.Name].Name)
+		assert.Len(t, handler.volumes, 1)
+		assert.Equal(t, instance.Name, handler.volumes[0].Name)
 
 		assert.Len(t, instance.opts.Volumes, 1)
 		assert.Equal(t, int64(1), instance.opts.Volumes[0].ID)
 	})
 
+	t.Run("success with format and mount path", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumeSize = 10
+		config.VolumeFormat = "xfs"
+		config.VolumeMountPath = "/var/lib/docker"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/volumes",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a", payload.Name)
+					require.Equal(t, "xfs", *payload.Format)
+				},
+				Status: 201,
+				JSON: schema.VolumeCreateResponse{
+					Volume: schema.Volume{ID: 1, Name: "fleeting-a"},
+					Action: &schema.Action{ID: 101, Status: "running"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+
+		assert.Len(t, instance.userDataParts, 1)
+		assert.Equal(t, cloudinit.ContentTypeCloudConfig, instance.userDataParts[0].ContentType)
+		assert.Equal(t, `#cloud-config
+mounts:
+  - ["/dev/disk/by-id/scsi-0HC_Volume_1", "/var/lib/docker", "auto", "defaults,nofail,discard", "0", "2"]
+`, instance.userDataParts[0].Content)
+	})
+
+	t.Run("success with multiple volumes", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumeSize = 10
+		config.VolumeFormat = "ext4"
+		config.VolumeMountPath = "/var/lib/docker"
+		config.Volumes = []VolumeConfig{
+			{Size: 20, Format: "xfs", Labels: map[string]string{"usage": "cache"}, MountPath: "/cache"},
+		}
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/volumes",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a", payload.Name)
+					require.Equal(t, 10, payload.Size)
+					require.Equal(t, "ext4", *payload.Format)
+				},
+				Status: 201,
+				JSON: schema.VolumeCreateResponse{
+					Volume: schema.Volume{ID: 1, Name: "fleeting-a"},
+					Action: &schema.Action{ID: 101, Status: "running"},
+				},
+			},
+			{
+				Method: "POST", Path: "/volumes",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a-1", payload.Name)
+					require.Equal(t, 20, payload.Size)
+					require.Equal(t, "xfs", *payload.Format)
+					require.Equal(t, &map[string]string{"instance-group": "fleeting", "fleeting-instance": "fleeting-a", "fleeting-volume": "1", "usage": "cache"}, payload.Labels)
+				},
+				Status: 201,
+				JSON: schema.VolumeCreateResponse{
+					Volume: schema.Volume{ID: 2, Name: "fleeting-a-1"},
+					Action: &schema.Action{ID: 102, Status: "running"},
+				},
+			},
+			{
+				Method: "GET", Path: "/actions?id=101&id=102&page=1&sort=status&sort=id",
+				Status: 200,
+				JSON: schema.ActionListResponse{
+					Actions: []schema.Action{
+						{ID: 101, Status: "success"},
+						{ID: 102, Status: "success"},
+					},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+		require.NoError(t, instance.wait())
+
+		assert.Len(t, handler.volumes, 2)
+		assert.Len(t, instance.opts.Volumes, 2)
+
+		assert.Len(t, instance.userDataParts, 1)
+		assert.Equal(t, `#cloud-config
+mounts:
+  - ["/dev/disk/by-id/scsi-0HC_Volume_1", "/var/lib/docker", "auto", "defaults,nofail,discard", "0", "2"]
+  - ["/dev/disk/by-id/scsi-0HC_Volume_2", "/cache", "auto", "defaults,nofail,discard", "0", "2"]
+`, instance.userDataParts[0].Content)
+	})
+
+	t.Run("success with label templates", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumeSize = 10
+		config.Labels = map[string]string{"server-type": "{{ .ServerType }}"}
+		config.Volumes = []VolumeConfig{
+			{Size: 20, Labels: map[string]string{"usage": `{{ index .Labels "server-type" }}`}},
+		}
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "POST", Path: "/volumes",
+				Status: 201,
+				JSON: schema.VolumeCreateResponse{
+					Volume: schema.Volume{ID: 1, Name: "fleeting-a"},
+				},
+			},
+			{
+				Method: "POST", Path: "/volumes",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeCreateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "cpx22", (*payload.Labels)["server-type"])
+					require.Equal(t, "cpx22", (*payload.Labels)["usage"])
+				},
+				Status: 201,
+				JSON: schema.VolumeCreateResponse{
+					Volume: schema.Volume{ID: 2, Name: "fleeting-a-1"},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+	})
+
+	t.Run("success with volume pool", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumeSize = 10
+		config.VolumePoolSize = 2
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Davailable&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.VolumeListResponse{
+					Volumes: []schema.Volume{
+						{ID: 4, Name: "fleeting-x", Size: 20, Location: schema.Location{Name: "hel1"}},
+						{ID: 5, Name: "fleeting-y", Size: 10, Location: schema.Location{Name: "hel1"},
+							Labels: map[string]string{"instance-group": "fleeting", "fleeting-state": "available"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/volumes/5",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a", payload.Name)
+					require.Equal(t, &map[string]string{"instance-group": "fleeting", "fleeting-instance": "fleeting-a", "fleeting-volume": "0"}, payload.Labels)
+				},
+				Status: 200,
+				JSON: schema.VolumeUpdateResponse{
+					Volume: schema.Volume{ID: 5, Name: "fleeting-a", Size: 10, Labels: map[string]string{"instance-group": "fleeting"}},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+		require.NoError(t, instance.wait())
+
+		assert.Len(t, instance.opts.Volumes, 1)
+		assert.Equal(t, int64(5), instance.opts.Volumes[0].ID)
+		assert.Len(t, handler.available, 1)
+		assert.Equal(t, 1, handler.pooled)
+	})
+
+	t.Run("success with volume pool and multiple volumes", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumeSize = 10
+		config.VolumePoolSize = 2
+		config.Volumes = []VolumeConfig{{Size: 10}}
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Davailable&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.VolumeListResponse{
+					Volumes: []schema.Volume{
+						{ID: 4, Name: "fleeting-x-1", Size: 10, Location: schema.Location{Name: "hel1"},
+							Labels: map[string]string{"instance-group": "fleeting", "fleeting-state": "available", "fleeting-volume": "1"}},
+						{ID: 5, Name: "fleeting-y", Size: 10, Location: schema.Location{Name: "hel1"},
+							Labels: map[string]string{"instance-group": "fleeting", "fleeting-state": "available", "fleeting-volume": "0"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/volumes/5",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a", payload.Name)
+					require.Equal(t, "0", (*payload.Labels)["fleeting-volume"])
+				},
+				Status: 200,
+				JSON: schema.VolumeUpdateResponse{
+					Volume: schema.Volume{ID: 5, Name: "fleeting-a", Size: 10},
+				},
+			},
+			{
+				Method: "PUT", Path: "/volumes/4",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "fleeting-a-1", payload.Name)
+					require.Equal(t, "1", (*payload.Labels)["fleeting-volume"])
+				},
+				Status: 200,
+				JSON: schema.VolumeUpdateResponse{
+					Volume: schema.Volume{ID: 4, Name: "fleeting-a-1", Size: 10},
+				},
+			},
+		})
+
+		instance := NewInstance("fleeting-a")
+		{
+			handler := &BaseHandler{}
+			require.NoError(t, handler.Create(ctx, group, instance))
+		}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreIncrease(ctx, group))
+		require.NoError(t, handler.Create(ctx, group, instance))
+		require.NoError(t, instance.wait())
+
+		assert.Len(t, instance.opts.Volumes, 2)
+		assert.Equal(t, int64(5), instance.opts.Volumes[0].ID)
+		assert.Equal(t, int64(4), instance.opts.Volumes[1].ID)
+		assert.Empty(t, handler.available)
+	})
+
 	t.Run("disabled", func(t *testing.T) {
 		ctx := context.Background()
 		config := DefaultTestConfig
@@ -106,6 +393,92 @@ func TestVolumeHandlerCleanup(t *testing.T) {
 		assert.Nil(t, instance.waitFn)
 	})
 
+	t.Run("success with multiple volumes", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.VolumeListResponse{
+					Volumes: []schema.Volume{
+						{ID: 1, Name: "fleeting-a"},
+						{ID: 2, Name: "fleeting-a-1", Labels: map[string]string{"fleeting-instance": "fleeting-a"}},
+						{ID: 3, Name: "renamed", Server: hcloud.Ptr(int64(1))},
+						{ID: 4, Name: "fleeting-a-2", Labels: map[string]string{"fleeting-instance": "fleeting-a-2"}},
+						{ID: 5, Name: "fleeting-b-1", Server: hcloud.Ptr(int64(2))},
+					},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/volumes/1",
+				Status: 204,
+			},
+			{
+				Method: "DELETE", Path: "/volumes/2",
+				Status: 204,
+			},
+			{
+				Method: "DELETE", Path: "/volumes/3",
+				Status: 204,
+			},
+		})
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreDecrease(ctx, group))
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+	})
+
+	t.Run("success with volume pool", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumePoolSize = 1
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.VolumeListResponse{
+					Volumes: []schema.Volume{
+						{ID: 1, Name: "fleeting-a", Labels: map[string]string{"instance-group": "fleeting", "fleeting-instance": "fleeting-a"}},
+						{ID: 2, Name: "fleeting-a-1", Labels: map[string]string{"instance-group": "fleeting", "fleeting-instance": "fleeting-a"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/volumes/1",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.VolumeUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Equal(t, "available", (*payload.Labels)["fleeting-state"])
+					require.NotEmpty(t, (*payload.Labels)["fleeting-released-at"])
+					require.Equal(t, "fleeting", (*payload.Labels)["instance-group"])
+					require.NotContains(t, *payload.Labels, "fleeting-instance")
+				},
+				Status: 200,
+				JSON: schema.VolumeUpdateResponse{
+					Volume: schema.Volume{ID: 1, Name: "fleeting-a"},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/volumes/2",
+				Status: 204,
+			},
+		})
+
+		instance := &Instance{Name: "fleeting-a", ID: 1}
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.PreDecrease(ctx, group))
+		require.NoError(t, handler.Cleanup(ctx, group, instance))
+		assert.Equal(t, 1, handler.pooled)
+	})
+
 	t.Run("passthrough", func(t *testing.T) {
 		ctx := context.Background()
 		config := DefaultTestConfig
@@ -130,3 +503,55 @@ func TestVolumeHandlerCleanup(t *testing.T) {
 		require.NoError(t, handler.Cleanup(ctx, group, instance))
 	})
 }
+
+func TestVolumeHandlerSanity(t *testing.T) {
+	t.Run("success with volume pool", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.VolumePoolSize = 1
+		config.VolumePoolIdleTimeout = time.Hour
+
+		now := time.Now()
+		releasedAt := func(d time.Duration) string {
+			return strconv.FormatInt(now.Add(-d).Unix(), 10)
+		}
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.VolumeListResponse{
+					Volumes: []schema.Volume{
+						{ID: 1, Name: "fleeting-a", Server: hcloud.Ptr(int64(1))},
+						{ID: 2, Name: "fleeting-b"},
+						{ID: 3, Name: "fleeting-c", Labels: map[string]string{
+							"fleeting-state": "available", "fleeting-released-at": releasedAt(2 * time.Minute),
+						}},
+						{ID: 4, Name: "fleeting-d", Labels: map[string]string{
+							"fleeting-state": "available", "fleeting-released-at": releasedAt(time.Minute),
+						}},
+						{ID: 5, Name: "fleeting-e", Labels: map[string]string{
+							"fleeting-state": "available", "fleeting-released-at": releasedAt(2 * time.Hour),
+						}},
+					},
+				},
+			},
+			{
+				Method: "DELETE", Path: "/volumes/2",
+				Status: 204,
+			},
+			{
+				Method: "DELETE", Path: "/volumes/3",
+				Status: 204,
+			},
+			{
+				Method: "DELETE", Path: "/volumes/5",
+				Status: 204,
+			},
+		})
+
+		handler := &VolumeHandler{}
+
+		require.NoError(t, handler.Sanity(ctx, group))
+	})
+}
@@ -32,6 +32,8 @@ func setupInstanceGroup(t *testing.T, config Config, requests []mockutil.Request
 			testutils.GetServerTypeCPX22Request,
 			testutils.GetServerTypeCX23Request,
 			testutils.GetImageDebian12Request,
+			testutils.GetStandbyServersRequest,
+			testutils.GetParkedServersRequest,
 			testutils.GetVolumesRequest,
 		},
 		requests...,
@@ -43,7 +45,7 @@ func setupInstanceGroup(t *testing.T, config Config, requests []mockutil.Request
 	log := hclog.New(hclog.DefaultOptions)
 
 	group := &instanceGroup{name: "fleeting", config: config, log: log, client: client}
-	group.randomNameFn = makeRandomNameFn(group.name)
+	group.randomIDFn = makeRandomIDFn()
 
 	err := group.Init(context.Background())
 	require.NoError(t, err)
@@ -51,19 +53,19 @@ func setupInstanceGroup(t *testing.T, config Config, requests []mockutil.Request
 	return group
 }
 
-func makeRandomNameFn(prefix string) func() string {
+func makeRandomIDFn() func() string {
 	offset := 96
 	index := 0
 	return func() string {
 		index++
-		return prefix + "-" + string(byte(offset+index))
+		return string(byte(offset + index))
 	}
 }
 
-func TestMakeRandomNameFn(t *testing.T) {
-	fn := makeRandomNameFn("fleeting")
-	require.Equal(t, "fleeting-a", fn())
-	require.Equal(t, "fleeting-b", fn())
-	require.Equal(t, "fleeting-c", fn())
-	require.Equal(t, "fleeting-d", fn())
+func TestMakeRandomIDFn(t *testing.T) {
+	fn := makeRandomIDFn()
+	require.Equal(t, "a", fn())
+	require.Equal(t, "b", fn())
+	require.Equal(t, "c", fn())
+	require.Equal(t, "d", fn())
 }
@@ -1,11 +1,18 @@
 package instancegroup
 
 import (
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
+	"net"
+	"net/netip"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/cloudinit"
 )
 
 type Instance struct {
@@ -17,6 +24,17 @@ type Instance struct {
 	// Server is the instance's underlying server, and must never be partially populated.
 	Server *hcloud.Server
 
+	// Static is set when the instance server is a static server, which was not created
+	// by the instance group.
+	Static bool
+
+	// SSHPrivateKey is the private key generated for the instance, only set when the
+	// instance group uses per instance ssh keys.
+	SSHPrivateKey []byte
+	// SSHHostKey is the public host key generated for the instance, in the authorized
+	// keys format, only set when the instance group uses per instance host keys.
+	SSHHostKey []byte
+
 	// waitFn is used to postpone long background/remote tasks in between each handlers.
 	//
 	// This allows to trigger the creation of 3 servers in parallel, and only wait once
@@ -27,6 +45,20 @@ type Instance struct {
 
 	// opts are used to configure the "create server" call during the [CreateHandler] phase.
 	opts *hcloud.ServerCreateOpts
+
+	// internalNetworkID is the ID of the network used for the instance internal address.
+	internalNetworkID int64
+	// ipv6HostOffset is the offset of the instance public IPv6 address in the server
+	// public IPv6 network. Defaults to 1.
+	ipv6HostOffset uint64
+
+	// userDataParts are composed with the user data during the [CreateHandler] phase.
+	userDataParts []cloudinit.Part
+
+	// recycled is set when the instance server is taken from or moved to a pool,
+	// instead of being created or deleted. The next handlers are skipped for the
+	// instance.
+	recycled bool
 }
 
 func NewInstance(name string) *Instance {
@@ -38,21 +70,25 @@ func InstanceFromServer(server *hcloud.Server) *Instance {
 }
 
 func InstanceFromIID(value string) (*Instance, error) {
-	parts := strings.Split(value, ":")
+	// Split on the last separator, the name may contain the separator
+	name, rawID, ok := cutLast(value, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("invalid instance id: %s", value)
+	}
 
-	// Handle iid and extract name and id
-	if len(parts) == 2 {
-		name := parts[0]
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse instance id: %w", err)
+	}
 
-		id, err := strconv.ParseInt(parts[1], 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("could not parse instance id: %w", err)
-		}
+	return &Instance{Name: name, ID: id}, nil
+}
 
-		return &Instance{Name: name, ID: id}, nil
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
 	}
-
-	return nil, fmt.Errorf("invalid instance id: %s", value)
+	return s, "", false
 }
 
 // IID holds to data to identify the instance outside of the instance group.
@@ -60,6 +96,75 @@ func (i *Instance) IID() string {
 	return fmt.Sprintf("%s:%d", i.Name, i.ID)
 }
 
+// CreatedAt returns the time the instance was created, which is the time its server
+// was taken from a pool for the recycled servers.
+func (i *Instance) CreatedAt() time.Time {
+	if value := takenAt(i.Server.Labels); !value.IsZero() {
+		return value
+	}
+	return i.Server.Created
+}
+
+// SSHHostKeyFingerprint returns the fingerprint of the host key generated for the
+// instance, stored in the server labels (see [HostKeyFingerprint]), or an empty string
+// for the servers created without host key.
+func (i *Instance) SSHHostKeyFingerprint() string {
+	return i.Server.Labels[hostKeyLabel]
+}
+
+// ShutdownAt returns the time the instance server was shut down before its deletion,
+// or the zero time if the server was not shut down by the instance group.
+func (i *Instance) ShutdownAt() time.Time {
+	return shutdownAt(i.Server.Labels)
+}
+
+// maxAgeJitter is the fraction of the max instance age used to spread the instances
+// expiry over time.
+const maxAgeJitter = 0.1
+
+// ExpiresAt returns the time after which the instance exceeds the max age, measured
+// from [Instance.CreatedAt]. The instances expire up to 10% before the max age, using
+// a jitter derived from the instance ID, so the instances created together do not
+// expire at once.
+func (i *Instance) ExpiresAt(maxAge time.Duration) time.Time {
+	hash := fnv.New64a()
+	hash.Write([]byte(strconv.FormatInt(i.ID, 10)))
+	jitter := time.Duration(float64(hash.Sum64()%1000) / 1000 * maxAgeJitter * float64(maxAge))
+
+	return i.CreatedAt().Add(maxAge - jitter)
+}
+
+// PublicIPv6 returns the public IPv6 address of the instance, which is by default the
+// first host of the server public IPv6 network.
+func (i *Instance) PublicIPv6() (netip.Addr, error) {
+	network, ok := netip.AddrFromSlice(i.Server.PublicNet.IPv6.IP)
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("could not parse server public ipv6: %s", i.Server.PublicNet.IPv6.IP.String())
+	}
+
+	offset := i.ipv6HostOffset
+	if offset == 0 {
+		offset = 1
+	}
+
+	// Add the offset to the interface identifier (last 64 bits) of the network.
+	addr := network.As16()
+	binary.BigEndian.PutUint64(addr[8:], binary.BigEndian.Uint64(addr[8:])+offset)
+
+	return netip.AddrFrom16(addr), nil
+}
+
+// InternalIP returns the IP of the instance in the internal network, or in the first
+// private network if the internal network is unknown.
+func (i *Instance) InternalIP() net.IP {
+	for _, privateNet := range i.Server.PrivateNet {
+		if i.internalNetworkID == 0 || (privateNet.Network != nil && privateNet.Network.ID == i.internalNetworkID) {
+			return privateNet.IP
+		}
+	}
+	return nil
+}
+
 func (i *Instance) wait() error {
 	if i.waitFn == nil {
 		return nil
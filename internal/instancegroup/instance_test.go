@@ -1,11 +1,15 @@
 package instancegroup
 
 import (
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
 )
 
 func TestInstanceFromServer(t *testing.T) {
@@ -33,8 +37,18 @@ func TestInstanceFromIID(t *testing.T) {
 			instance: nil,
 		},
 		{
-			name:     "fail to many separator",
+			name:     "success separator in name",
 			iid:      "fleeting:a:1",
+			instance: &Instance{Name: "fleeting:a", ID: 1},
+		},
+		{
+			name:     "fail empty name",
+			iid:      ":1",
+			instance: nil,
+		},
+		{
+			name:     "fail invalid id",
+			iid:      "fleeting-a:b",
 			instance: nil,
 		},
 	}
@@ -69,3 +83,83 @@ func TestInstanceIID(t *testing.T) {
 		})
 	}
 }
+
+func TestInstanceCreatedAt(t *testing.T) {
+	created := time.Unix(1700000000, 0)
+
+	instance := InstanceFromServer(&hcloud.Server{ID: 1, Name: "fleeting-a", Created: created})
+	require.Equal(t, created, instance.CreatedAt())
+
+	// The recycled servers are created when taken from a pool
+	instance.Server.Labels = map[string]string{"fleeting-taken-at": "1700003600"}
+	require.Equal(t, created.Add(time.Hour), instance.CreatedAt())
+}
+
+func TestInstanceExpiresAt(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expiries := make(map[time.Time]struct{})
+	for id := range int64(20) {
+		instance := &Instance{Name: "fleeting", ID: id, Server: &hcloud.Server{Created: created}}
+
+		expiresAt := instance.ExpiresAt(10 * time.Hour)
+		assert.False(t, expiresAt.After(created.Add(10*time.Hour)))
+		assert.True(t, expiresAt.After(created.Add(9*time.Hour)))
+
+		// The jitter is stable for an instance
+		assert.Equal(t, expiresAt, instance.ExpiresAt(10*time.Hour))
+
+		expiries[expiresAt] = struct{}{}
+	}
+
+	// The expiries are spread over time
+	require.Greater(t, len(expiries), 10)
+
+	// The age of the recycled instances is measured from the take
+	taken := created.Add(24 * time.Hour)
+	instance := &Instance{Name: "fleeting", ID: 1, Server: &hcloud.Server{
+		Created: created,
+		Labels:  map[string]string{takenAtLabel: strconv.FormatInt(taken.Unix(), 10)},
+	}}
+	expiresAt := instance.ExpiresAt(10 * time.Hour)
+	assert.False(t, expiresAt.After(taken.Add(10*time.Hour)))
+	assert.True(t, expiresAt.After(taken.Add(9*time.Hour)))
+}
+
+func TestInstancePublicIPv6(t *testing.T) {
+	instance := InstanceFromServer(hcloud.ServerFromSchema(schema.Server{
+		ID:   1,
+		Name: "fleeting-a",
+		PublicNet: schema.ServerPublicNet{
+			IPv6: schema.ServerPublicNetIPv6{IP: "2a01:4f8:1c19:1403::/64"},
+		},
+	}))
+
+	ipv6, err := instance.PublicIPv6()
+	require.NoError(t, err)
+	require.Equal(t, "2a01:4f8:1c19:1403::1", ipv6.String())
+
+	instance.ipv6HostOffset = 0x1_0000_0002
+	ipv6, err = instance.PublicIPv6()
+	require.NoError(t, err)
+	require.Equal(t, "2a01:4f8:1c19:1403:0:1:0:2", ipv6.String())
+}
+
+func TestInstanceInternalIP(t *testing.T) {
+	instance := InstanceFromServer(hcloud.ServerFromSchema(schema.Server{
+		ID:   1,
+		Name: "fleeting-a",
+		PrivateNet: []schema.ServerPrivateNet{
+			{Network: 1, IP: "10.0.1.2"},
+			{Network: 2, IP: "10.1.1.2"},
+		},
+	}))
+
+	require.Equal(t, "10.0.1.2", instance.InternalIP().String())
+
+	instance.internalNetworkID = 2
+	require.Equal(t, "10.1.1.2", instance.InternalIP().String())
+
+	instance.internalNetworkID = 3
+	require.Nil(t, instance.InternalIP())
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"maps"
+	"net"
+	"net/netip"
 	"reflect"
 	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"text/template"
 
 	"github.com/hashicorp/go-hclog"
 
@@ -21,6 +26,10 @@ type InstanceGroup interface {
 
 	Increase(ctx context.Context, delta int) ([]string, error)
 	Decrease(ctx context.Context, iids []string) ([]string, error)
+	// Delete deletes the instances like [InstanceGroup.Decrease], without moving them
+	// to a pool nor shutting them down first. It is used for the instances that must
+	// not be reused.
+	Delete(ctx context.Context, iids []string) ([]string, error)
 
 	List(ctx context.Context) ([]*Instance, error)
 	Get(ctx context.Context, iid string) (*Instance, error)
@@ -54,17 +63,35 @@ type instanceGroup struct {
 	serverTypesArchitecture hcloud.Architecture
 	image                   *hcloud.Image
 	privateNetworks         []*hcloud.Network
+	internalNetwork         *hcloud.Network
+	internalNetworkIPRange  *net.IPNet
+	internalNetworkAliasIPs netip.Prefix
 	sshKeys                 []*hcloud.SSHKey
-	labels                  map[string]string
-
-	randomNameFn func() string
+	managedSSHKey           *hcloud.SSHKey
+	volumes                 []VolumeConfig
+	labelTemplates          map[string]*template.Template
+	volumeLabelTemplates    []map[string]*template.Template
+	reverseDNSTemplate      *template.Template
+	userDataTemplate        *template.Template
+	nameTemplate            *template.Template
+
+	// instanceKeys holds the keys generated for the instance servers by server ID.
+	instanceKeys   map[int64]instanceKeys
+	instanceKeysMu sync.Mutex
+
+	// foreignOwners holds the other owners found in the instance group.
+	foreignOwners   map[string]struct{}
+	foreignOwnersMu sync.Mutex
+
+	// nameSequence is the sequence number of the last instance name.
+	nameSequence atomic.Int64
+
+	randomIDFn func() string
 }
 
 func (g *instanceGroup) Init(ctx context.Context) (err error) {
-	if g.randomNameFn == nil {
-		g.randomNameFn = func() string {
-			return g.name + "-" + randutil.GenerateID()
-		}
+	if g.randomIDFn == nil {
+		g.randomIDFn = randutil.GenerateID
 	}
 
 	// Location
@@ -116,42 +143,211 @@ func (g *instanceGroup) Init(ctx context.Context) (err error) {
 		}
 
 		g.privateNetworks = append(g.privateNetworks, network)
+
+		if g.config.InternalNetwork == network.Name || g.config.InternalNetwork == strconv.FormatInt(network.ID, 10) {
+			g.internalNetwork = network
+		}
+	}
+
+	// Internal Network
+	if g.config.InternalNetwork != "" {
+		if g.internalNetwork == nil {
+			return fmt.Errorf("internal network not found in private networks: %s", g.config.InternalNetwork)
+		}
+	} else if len(g.privateNetworks) > 0 {
+		g.internalNetwork = g.privateNetworks[0]
+	}
+
+	if err := g.validatePrivateNetworks(); err != nil {
+		return err
+	}
+
+	if g.config.InternalNetworkIPRange != "" {
+		if g.internalNetwork == nil {
+			return fmt.Errorf("internal network ip range requires a private network")
+		}
+
+		_, g.internalNetworkIPRange, err = net.ParseCIDR(g.config.InternalNetworkIPRange)
+		if err != nil {
+			return fmt.Errorf("could not parse internal network ip range: %w", err)
+		}
+	}
+
+	if g.config.InternalNetworkAliasIPCount > 0 {
+		if g.internalNetwork == nil {
+			return fmt.Errorf("internal network alias ips requires a private network")
+		}
+
+		g.internalNetworkAliasIPs, err = netip.ParsePrefix(g.config.InternalNetworkAliasIPRange)
+		if err != nil {
+			return fmt.Errorf("could not parse internal network alias ip range: %w", err)
+		}
+		g.internalNetworkAliasIPs = g.internalNetworkAliasIPs.Masked()
+	}
+
+	// The server must be created with a public ip or another network, the internal
+	// network being attached after the creation.
+	if g.attachInternalNetworkAfterCreate() && g.config.PublicIPv4Disabled && g.config.PublicIPv6Disabled && len(g.privateNetworks) == 1 {
+		return fmt.Errorf("internal network ip range and alias ips require a public ip or another private network")
 	}
 
 	// SSH Keys
 	g.sshKeys = make([]*hcloud.SSHKey, 0, len(g.config.SSHKeys))
 	for _, sshKeyID := range g.config.SSHKeys {
-		sshKey, _, err := g.client.SSHKey.Get(ctx, sshKeyID)
-		if err != nil {
-			return fmt.Errorf("could not get ssh key: %w", err)
+		var sshKeys []*hcloud.SSHKey
+
+		if IsLabelSelector(sshKeyID) {
+			sshKeys, err = g.client.SSHKey.AllWithOpts(ctx, hcloud.SSHKeyListOpts{
+				ListOpts: hcloud.ListOpts{LabelSelector: sshKeyID},
+			})
+			if err != nil {
+				return fmt.Errorf("could not list ssh keys: %w", err)
+			}
+			if len(sshKeys) == 0 {
+				return fmt.Errorf("no ssh key found matching the label selector: %s", sshKeyID)
+			}
+		} else {
+			sshKey, _, err := g.client.SSHKey.Get(ctx, sshKeyID)
+			if err != nil {
+				return fmt.Errorf("could not get ssh key: %w", err)
+			}
+			if sshKey == nil {
+				return fmt.Errorf("ssh key not found: %s", sshKeyID)
+			}
+			sshKeys = []*hcloud.SSHKey{sshKey}
 		}
-		if sshKey == nil {
-			return fmt.Errorf("ssh key not found: %s", sshKeyID)
+
+		for _, sshKey := range sshKeys {
+			// A key may be matched by several entries
+			if slices.ContainsFunc(g.sshKeys, func(other *hcloud.SSHKey) bool { return other.ID == sshKey.ID }) {
+				continue
+			}
+
+			g.sshKeys = append(g.sshKeys, sshKey)
+
+			if g.config.ManagedSSHKey == sshKey.Name || g.config.ManagedSSHKey == strconv.FormatInt(sshKey.ID, 10) {
+				g.managedSSHKey = sshKey
+			}
 		}
+	}
+
+	if g.config.ManagedSSHKey != "" && g.managedSSHKey == nil {
+		return fmt.Errorf("managed ssh key not found in ssh keys: %s", g.config.ManagedSSHKey)
+	}
 
-		g.sshKeys = append(g.sshKeys, sshKey)
+	// Volumes
+	g.volumes = make([]VolumeConfig, 0, len(g.config.Volumes)+1)
+	if g.config.VolumeSize > 0 {
+		g.volumes = append(g.volumes, VolumeConfig{
+			Size:      g.config.VolumeSize,
+			Format:    g.config.VolumeFormat,
+			MountPath: g.config.VolumeMountPath,
+		})
+	}
+	g.volumes = append(g.volumes, g.config.Volumes...)
+
+	g.volumeLabelTemplates = make([]map[string]*template.Template, 0, len(g.volumes))
+	for _, volume := range g.volumes {
+		templates, err := newLabelTemplates(volume.Labels)
+		if err != nil {
+			return fmt.Errorf("could not parse volume labels: %w", err)
+		}
+		g.volumeLabelTemplates = append(g.volumeLabelTemplates, templates)
 	}
 
-	g.labels = make(map[string]string, len(g.config.Labels)+1)
-	if g.config.Labels != nil {
-		maps.Copy(g.labels, g.config.Labels)
+	g.labelTemplates, err = newLabelTemplates(g.config.Labels)
+	if err != nil {
+		return fmt.Errorf("could not parse labels: %w", err)
 	}
-	g.labels["instance-group"] = g.name
 
 	if g.config.PublicIPPoolEnabled {
 		g.ipPool = ippool.New(g.config.Location, g.config.PublicIPPoolSelector)
 	}
 
+	if g.config.ReverseDNSTemplate != "" {
+		g.reverseDNSTemplate, err = NewTemplate("reverse dns template", g.config.ReverseDNSTemplate)
+		if err != nil {
+			return fmt.Errorf("could not parse reverse dns template: %w", err)
+		}
+	}
+
+	nameTemplate := g.config.NameTemplate
+	if nameTemplate == "" {
+		nameTemplate = defaultNameTemplate
+	}
+	g.nameTemplate, err = NewNameTemplate(nameTemplate)
+	if err != nil {
+		return fmt.Errorf("could not parse name template: %w", err)
+	}
+	// Ensure the name is valid with the actual instance group values.
+	if _, err := renderName(g.nameTemplate, g.nameTemplateData(1, exampleNameTemplateData.Random)); err != nil {
+		return fmt.Errorf("could not render name template: %w", err)
+	}
+
+	if g.config.UserDataTemplate {
+		g.userDataTemplate, err = NewTemplate("user data", g.config.UserData)
+		if err != nil {
+			return fmt.Errorf("could not parse user data template: %w", err)
+		}
+	}
+
 	// Run sanity checks before starting.
 	return g.Sanity(ctx, true)
 }
 
+// validatePrivateNetworks ensures that the instances are reachable and have outbound
+// connectivity when they only have private networks.
+func (g *instanceGroup) validatePrivateNetworks() error {
+	if !g.config.PublicIPv4Disabled || !g.config.PublicIPv6Disabled {
+		return nil
+	}
+
+	if len(g.privateNetworks) == 0 {
+		return fmt.Errorf("private networks are required when both public ipv4 and public ipv6 are disabled")
+	}
+
+	errs := make([]error, 0)
+	hasDefaultRoute := false
+
+	for _, network := range g.privateNetworks {
+		if !slices.ContainsFunc(network.Subnets, func(subnet hcloud.NetworkSubnet) bool {
+			return subnet.NetworkZone == g.location.NetworkZone
+		}) {
+			errs = append(errs, fmt.Errorf("network %s has no subnet in the network zone %s of the location %s, add a subnet in this network zone",
+				network.Name, g.location.NetworkZone, g.location.Name))
+		}
+
+		if slices.ContainsFunc(network.Routes, func(route hcloud.NetworkRoute) bool {
+			return route.Destination != nil && route.Destination.IP.Equal(net.IPv4zero) && isZeroMask(route.Destination.Mask)
+		}) {
+			hasDefaultRoute = true
+		}
+	}
+
+	if !hasDefaultRoute {
+		errs = append(errs, fmt.Errorf("no private network has a default route (0.0.0.0/0), add a route to a NAT gateway for outbound traffic"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func isZeroMask(mask net.IPMask) bool {
+	ones, _ := mask.Size()
+	return ones == 0
+}
+
 func (g *instanceGroup) Increase(ctx context.Context, delta int) ([]string, error) {
 	handlers := []CreateHandler{
-		&BaseHandler{},   // Configure the instance server create options from the instance group config.
-		&IPPoolHandler{}, // Configure the IPs in the instance server create options.
-		&VolumeHandler{}, // Create and configure a volume in the instance server create options.
-		&ServerHandler{}, // Create a server from the instance server create options.
+		&StaticHandler{},         // Take the instance server from the released static servers.
+		&ParkingHandler{},        // Take the instance server from the parked servers.
+		&StandbyHandler{},        // Take the instance server from the standby pool.
+		&BaseHandler{},           // Configure the instance server create options from the instance group config.
+		&InstanceSSHKeyHandler{}, // Generate the instance ssh key.
+		&HostKeyHandler{},        // Generate the instance ssh host key.
+		&IPPoolHandler{},         // Configure the IPs in the instance server create options.
+		&VolumeHandler{},         // Create and configure the volumes in the instance server create options.
+		&ServerHandler{},         // Create a server from the instance server create options.
+		&ReverseDNSHandler{},     // Set the reverse DNS of the server public IPs.
 	}
 
 	// Run all pre increase handlers
@@ -170,10 +366,15 @@ func (g *instanceGroup) Increase(ctx context.Context, delta int) ([]string, erro
 
 	instances := make([]*Instance, 0, delta)
 	failed := make([]*Instance, 0, delta)
+	recycled := make([]*Instance, 0, delta)
 
 	// Create a list of new instances
 	for range delta {
-		instances = append(instances, NewInstance(g.randomNameFn()))
+		name, err := g.instanceName()
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, NewInstance(name))
 	}
 
 	// Run all create handlers on each instance
@@ -198,6 +399,8 @@ func (g *instanceGroup) Increase(ctx context.Context, delta int) ([]string, erro
 				if err := instance.wait(); err != nil {
 					errs = append(errs, err)
 					failed = append(failed, instance)
+				} else if instance.recycled {
+					recycled = append(recycled, instance)
 				} else {
 					succeeded = append(succeeded, instance)
 				}
@@ -234,8 +437,8 @@ func (g *instanceGroup) Increase(ctx context.Context, delta int) ([]string, erro
 	}
 
 	// Collect created instances IIDs
-	created := make([]string, 0, len(instances))
-	for _, instance := range instances {
+	created := make([]string, 0, len(recycled)+len(instances))
+	for _, instance := range slices.Concat(recycled, instances) {
 		created = append(created, instance.IID())
 	}
 
@@ -243,11 +446,29 @@ func (g *instanceGroup) Increase(ctx context.Context, delta int) ([]string, erro
 }
 
 func (g *instanceGroup) Decrease(ctx context.Context, iids []string) ([]string, error) {
+	handlers := []CleanupHandler{
+		&StandbyHandler{},  // Move the instance server to the standby pool.
+		&ParkingHandler{},  // Park the instance server until its next billing boundary.
+		&ShutdownHandler{}, // Shutdown the server of the instance.
+		&ServerHandler{},   // Delete the server of the instance.
+		&VolumeHandler{},   // Delete the volumes of the instance.
+	}
+
+	return g.decrease(ctx, iids, handlers)
+}
+
+func (g *instanceGroup) Delete(ctx context.Context, iids []string) ([]string, error) {
 	handlers := []CleanupHandler{
 		&ServerHandler{}, // Delete the server of the instance.
-		&VolumeHandler{}, // Delete the volume of the instance.
+		&VolumeHandler{}, // Delete the volumes of the instance.
 	}
 
+	return g.decrease(ctx, iids, handlers)
+}
+
+// decrease runs the cleanup handlers on the instances, the static instances are
+// released instead.
+func (g *instanceGroup) decrease(ctx context.Context, iids []string, handlers []CleanupHandler) ([]string, error) {
 	// Run all pre decrease handlers
 	for _, handler := range handlers {
 		h, ok := handler.(PreDecreaseHandler)
@@ -263,6 +484,7 @@ func (g *instanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 	errs := make([]error, 0)
 
 	instances := make([]*Instance, 0, len(iids))
+	recycled := make([]*Instance, 0, len(iids))
 
 	// Populate a list of instances from their IIDs
 	for _, iid := range iids {
@@ -274,6 +496,36 @@ func (g *instanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 		instances = append(instances, instance)
 	}
 
+	// Release the static instances, instead of deleting them
+	if g.config.StaticInstancesSelector != "" {
+		servers, err := g.listStaticServers(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		staticServers := make(map[int64]*hcloud.Server, len(servers))
+		for _, server := range servers {
+			staticServers[server.ID] = server
+		}
+
+		static := make([]*Instance, 0)
+		instances = slices.DeleteFunc(instances, func(instance *Instance) bool {
+			if _, ok := staticServers[instance.ID]; ok {
+				static = append(static, instance)
+				return true
+			}
+			return false
+		})
+
+		if len(static) > 0 {
+			released, err := g.releaseStaticInstances(ctx, static, staticServers)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			recycled = append(recycled, released...)
+		}
+	}
+
 	// Run all cleanup handlers on each instance
 	for _, handler := range handlers {
 		{
@@ -294,6 +546,8 @@ func (g *instanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 			for _, instance := range instances {
 				if err := instance.wait(); err != nil {
 					errs = append(errs, err)
+				} else if instance.recycled {
+					recycled = append(recycled, instance)
 				} else {
 					succeeded = append(succeeded, instance)
 				}
@@ -303,8 +557,8 @@ func (g *instanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 	}
 
 	// Collect deleted instances IIDs
-	deleted := make([]string, 0, len(instances))
-	for _, instance := range instances {
+	deleted := make([]string, 0, len(recycled)+len(instances))
+	for _, instance := range slices.Concat(recycled, instances) {
 		deleted = append(deleted, instance.IID())
 	}
 
@@ -312,6 +566,32 @@ func (g *instanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 }
 
 func (g *instanceGroup) List(ctx context.Context) ([]*Instance, error) {
+	servers, err := g.listServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	staticServers, err := g.listStaticServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	servers = append(servers, staticServers...)
+
+	instances := make([]*Instance, 0, len(servers))
+	for _, server := range servers {
+		// Hide the servers kept in a pool and the released static servers
+		if server.Labels[stateLabel] != "" {
+			continue
+		}
+		instances = append(instances, g.instanceFromServer(server))
+	}
+
+	return instances, nil
+}
+
+// listServers returns all the servers of the instance group, including the servers
+// kept in a pool.
+func (g *instanceGroup) listServers(ctx context.Context) ([]*hcloud.Server, error) {
 	servers, err := g.client.Server.AllWithOpts(ctx,
 		hcloud.ServerListOpts{
 			ListOpts: hcloud.ListOpts{
@@ -322,13 +602,7 @@ func (g *instanceGroup) List(ctx context.Context) ([]*Instance, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not list instances: %w", err)
 	}
-
-	instances := make([]*Instance, 0, len(servers))
-	for _, server := range servers {
-		instances = append(instances, InstanceFromServer(server))
-	}
-
-	return instances, nil
+	return g.ownedServers(servers), nil
 }
 
 func (g *instanceGroup) Get(ctx context.Context, iid string) (*Instance, error) {
@@ -342,7 +616,29 @@ func (g *instanceGroup) Get(ctx context.Context, iid string) (*Instance, error)
 		return nil, fmt.Errorf("could not get instance: %w", err)
 	}
 
-	return InstanceFromServer(server), nil
+	return g.instanceFromServer(server), nil
+}
+
+// instanceFromServer creates an instance from a server, with the instance group
+// specific details.
+func (g *instanceGroup) instanceFromServer(server *hcloud.Server) *Instance {
+	instance := InstanceFromServer(server)
+	instance.Static = server.Labels["instance-group"] == ""
+	if keys, ok := g.getInstanceKeys(server.ID); ok {
+		instance.SSHPrivateKey = keys.sshPrivateKey
+		instance.SSHHostKey = keys.sshHostKey
+	}
+	if g.internalNetwork != nil {
+		instance.internalNetworkID = g.internalNetwork.ID
+	}
+	instance.ipv6HostOffset = g.config.PublicIPv6HostOffset
+	return instance
+}
+
+// attachInternalNetworkAfterCreate reports whether the internal network must be
+// attached after the server creation, to allocate the server IPs in the network.
+func (g *instanceGroup) attachInternalNetworkAfterCreate() bool {
+	return g.internalNetworkIPRange != nil || g.config.InternalNetworkAliasIPCount > 0
 }
 
 func (g *instanceGroup) Sanity(ctx context.Context, init bool) error {
@@ -350,9 +646,26 @@ func (g *instanceGroup) Sanity(ctx context.Context, init bool) error {
 		&DeprecationHandler{}, // Check deprecations.
 	}
 
+	// Only run standby handler when configured by the user or during init to clean left
+	// overs from a previous config.
+	if g.config.StandbyPoolSize > 0 || init {
+		handlers = append(handlers, &StandbyHandler{}) // Delete expired standby instances.
+	}
+
+	// Only run parking handler when configured by the user or during init to clean left
+	// overs from a previous config.
+	if g.config.BillingAwareScaleDown || init {
+		handlers = append(handlers, &ParkingHandler{}) // Delete parked instances close to their billing boundary.
+	}
+
+	// Only run ssh key handler when the plugin manages the ssh keys.
+	if g.managedSSHKey != nil {
+		handlers = append(handlers, &SSHKeyHandler{}) // Delete unused ssh keys.
+	}
+
 	// Only run volume handler when configured by the user or during init to clean left
 	// overs from a previous config.
-	if g.config.VolumeSize > 0 || init {
+	if len(g.volumes) > 0 || init {
 		handlers = append(handlers, &VolumeHandler{}) // Delete dangling volumes.
 	}
 
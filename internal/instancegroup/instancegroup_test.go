@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/go-hclog"
 	"github.com/stretchr/testify/require"
@@ -65,6 +66,8 @@ func TestInit(t *testing.T) {
 							SSHKeys: []schema.SSHKey{{ID: 1, Name: "ssh-key"}},
 						},
 					},
+					testutils.GetStandbyServersRequest,
+					testutils.GetParkedServersRequest,
 					testutils.GetVolumesRequest,
 				})
 
@@ -76,7 +79,235 @@ func TestInit(t *testing.T) {
 				require.Equal(t, "debian-12", group.image.Name)
 				require.Equal(t, "network", group.privateNetworks[0].Name)
 				require.Equal(t, "ssh-key", group.sshKeys[0].Name)
-				require.Equal(t, map[string]string{"instance-group": "fleeting", "key": "value"}, group.labels)
+				labels, err := group.instanceLabels(exampleTemplateData)
+				require.NoError(t, err)
+				require.Equal(t, map[string]string{"instance-group": "fleeting", "key": "value"}, labels)
+			},
+		},
+		{
+			name: "success ssh keys",
+			config: Config{
+				Location:      "hel1",
+				ServerTypes:   []string{"cpx22"},
+				Image:         "debian-12",
+				SSHKeys:       []string{"team=oncall", "fleeting", "2"},
+				ManagedSSHKey: "fleeting",
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+					{
+						Method: "GET", Path: "/ssh_keys?label_selector=team%3Doncall&page=1&per_page=50",
+						Status: 200,
+						JSON: schema.SSHKeyListResponse{
+							SSHKeys: []schema.SSHKey{{ID: 2, Name: "alice"}, {ID: 3, Name: "bob"}},
+						},
+					},
+					{
+						Method: "GET", Path: "/ssh_keys?name=fleeting",
+						Status: 200,
+						JSON: schema.SSHKeyListResponse{
+							SSHKeys: []schema.SSHKey{{ID: 1, Name: "fleeting"}},
+						},
+					},
+					{
+						Method: "GET", Path: "/ssh_keys/2",
+						Status: 200,
+						JSON: schema.SSHKeyGetResponse{
+							SSHKey: schema.SSHKey{ID: 2, Name: "alice"},
+						},
+					},
+					testutils.GetStandbyServersRequest,
+					testutils.GetParkedServersRequest,
+					{
+						Method: "GET", Path: "/ssh_keys?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+						Status: 200,
+						JSON:   schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{}},
+					},
+					{
+						Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+						Status: 200,
+						JSON:   schema.ServerListResponse{Servers: []schema.Server{}},
+					},
+					testutils.GetVolumesRequest,
+				})
+
+				err := group.Init(context.Background())
+				require.NoError(t, err)
+
+				require.Len(t, group.sshKeys, 3)
+				require.Equal(t, "alice", group.sshKeys[0].Name)
+				require.Equal(t, "bob", group.sshKeys[1].Name)
+				require.Equal(t, "fleeting", group.sshKeys[2].Name)
+				require.Equal(t, int64(1), group.managedSSHKey.ID)
+			},
+		},
+		{
+			name: "invalid ssh keys label selector",
+			config: Config{
+				Location:    "hel1",
+				ServerTypes: []string{"cpx22"},
+				Image:       "debian-12",
+				SSHKeys:     []string{"team=oncall"},
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+					{
+						Method: "GET", Path: "/ssh_keys?label_selector=team%3Doncall&page=1&per_page=50",
+						Status: 200,
+						JSON:   schema.SSHKeyListResponse{SSHKeys: []schema.SSHKey{}},
+					},
+				})
+
+				err := group.Init(context.Background())
+				require.EqualError(t, err, "no ssh key found matching the label selector: team=oncall")
+			},
+		},
+		{
+			name: "invalid internal network",
+			config: Config{
+				Location:        "hel1",
+				ServerTypes:     []string{"cpx22"},
+				Image:           "debian-12",
+				PrivateNetworks: []string{"network"},
+				InternalNetwork: "other",
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+					{
+						Method: "GET", Path: "/networks?name=network",
+						Status: 200,
+						JSON: schema.NetworkListResponse{
+							Networks: []schema.Network{{ID: 1, Name: "network"}},
+						},
+					},
+				})
+
+				err := group.Init(context.Background())
+				require.EqualError(t, err, "internal network not found in private networks: other")
+			},
+		},
+		{
+			name: "success private networks only",
+			config: Config{
+				Location:           "hel1",
+				ServerTypes:        []string{"cpx22"},
+				Image:              "debian-12",
+				PrivateNetworks:    []string{"network"},
+				PublicIPv4Disabled: true,
+				PublicIPv6Disabled: true,
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+					{
+						Method: "GET", Path: "/networks?name=network",
+						Status: 200,
+						JSON: schema.NetworkListResponse{
+							Networks: []schema.Network{{
+								ID:   1,
+								Name: "network",
+								Subnets: []schema.NetworkSubnet{
+									{Type: "cloud", IPRange: "10.0.1.0/24", NetworkZone: "eu-central", Gateway: "10.0.0.1"},
+								},
+								Routes: []schema.NetworkRoute{
+									{Destination: "0.0.0.0/0", Gateway: "10.0.1.2"},
+								},
+							}},
+						},
+					},
+					testutils.GetStandbyServersRequest,
+					testutils.GetParkedServersRequest,
+					testutils.GetVolumesRequest,
+				})
+
+				err := group.Init(context.Background())
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "invalid private networks only",
+			config: Config{
+				Location:           "hel1",
+				ServerTypes:        []string{"cpx22"},
+				Image:              "debian-12",
+				PrivateNetworks:    []string{"network"},
+				PublicIPv4Disabled: true,
+				PublicIPv6Disabled: true,
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+					{
+						Method: "GET", Path: "/networks?name=network",
+						Status: 200,
+						JSON: schema.NetworkListResponse{
+							Networks: []schema.Network{{
+								ID:   1,
+								Name: "network",
+								Subnets: []schema.NetworkSubnet{
+									{Type: "cloud", IPRange: "10.0.1.0/24", NetworkZone: "us-east", Gateway: "10.0.0.1"},
+								},
+							}},
+						},
+					},
+				})
+
+				err := group.Init(context.Background())
+				require.EqualError(t, err, `network network has no subnet in the network zone eu-central of the location hel1, add a subnet in this network zone
+no private network has a default route (0.0.0.0/0), add a route to a NAT gateway for outbound traffic`)
+			},
+		},
+		{
+			name: "invalid no private networks",
+			config: Config{
+				Location:           "hel1",
+				ServerTypes:        []string{"cpx22"},
+				Image:              "debian-12",
+				PublicIPv4Disabled: true,
+				PublicIPv6Disabled: true,
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+				})
+
+				err := group.Init(context.Background())
+				require.EqualError(t, err, "private networks are required when both public ipv4 and public ipv6 are disabled")
+			},
+		},
+		{
+			name: "invalid name template",
+			config: Config{
+				Location:     "hel1",
+				ServerTypes:  []string{"cpx22"},
+				Image:        "debian-12",
+				NameTemplate: "{{ .GroupName }}-{{ .ServerType }}-{{ .Location }}-{{ .Random }}-runner-with-a-very-very-very-long-name",
+			},
+			run: func(t *testing.T, group *instanceGroup, server *mockutil.Server) {
+				server.Expect([]mockutil.Request{
+					testutils.GetLocationHel1Request,
+					testutils.GetServerTypeCPX22Request,
+					testutils.GetImageDebian12Request,
+				})
+
+				err := group.Init(context.Background())
+				require.EqualError(t, err, "could not parse name template: invalid instance name: "+
+					"fleeting-cpx22-hel1-a1b2c3d4-runner-with-a-very-very-very-long-name: name is longer than 63 characters")
 			},
 		},
 		{
@@ -168,7 +399,7 @@ func TestIncrease(t *testing.T) {
 						mustUnmarshal(t, r.Body, &payload)
 						require.Equal(t, "fleeting-a", payload.Name)
 						require.Equal(t, 10, payload.Size)
-						require.Equal(t, &map[string]string{"instance-group": "fleeting"}, payload.Labels)
+						require.Equal(t, &map[string]string{"instance-group": "fleeting", "fleeting-instance": "fleeting-a", "fleeting-volume": "0"}, payload.Labels)
 					},
 					Status: 201,
 					JSON: schema.VolumeCreateResponse{
@@ -442,6 +673,114 @@ func TestDecrease(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, []string{"fleeting-a:1", "fleeting-b:2"}, deleted)
 	})
+
+	t.Run("success static instances", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StaticInstancesSelector = "pool=static"
+		config.StaticInstancesDecreasePolicy = StaticDecreasePolicyRebuild
+
+		group := setupInstanceGroup(t, config,
+			[]mockutil.Request{
+				testutils.GetVolumesRequest,
+				{
+					Method: "GET", Path: "/servers?label_selector=pool%3Dstatic&page=1&per_page=50",
+					Status: 200,
+					JSON: schema.ServerListResponse{
+						Servers: []schema.Server{
+							{ID: 2, Name: "static-b", Labels: map[string]string{"pool": "static"}},
+						},
+					},
+				},
+				{
+					Method: "POST", Path: "/servers/2/actions/rebuild",
+					Status: 201,
+					JSON: schema.ServerActionRebuildResponse{
+						Action: schema.Action{ID: 201, Status: "running"},
+					},
+				},
+				{
+					Method: "GET", Path: "/actions?id=201&page=1&sort=status&sort=id",
+					Status: 200,
+					JSON: schema.ActionListResponse{
+						Actions: []schema.Action{{ID: 201, Status: "success"}},
+					},
+				},
+				{
+					Method: "PUT", Path: "/servers/2",
+					Want: func(t *testing.T, r *http.Request) {
+						var payload schema.ServerUpdateRequest
+						mustUnmarshal(t, r.Body, &payload)
+						require.Equal(t, "static", (*payload.Labels)["pool"])
+						require.Equal(t, "released", (*payload.Labels)["fleeting-state"])
+					},
+					Status: 200,
+					JSON: schema.ServerUpdateResponse{
+						Server: schema.Server{ID: 2, Name: "static-b"},
+					},
+				},
+				{
+					Method: "DELETE", Path: "/servers/1",
+					Status: 200,
+					JSON: schema.ServerDeleteResponse{
+						Action: schema.Action{ID: 103, Status: "running"},
+					},
+				},
+				{
+					Method: "GET", Path: "/actions?id=103&page=1&sort=status&sort=id",
+					Status: 200,
+					JSON: schema.ActionListResponse{
+						Actions: []schema.Action{{ID: 103, Status: "success"}},
+					},
+				},
+			},
+		)
+
+		deleted, err := group.Decrease(ctx, []string{"fleeting-a:1", "static-b:2"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"static-b:2", "fleeting-a:1"}, deleted)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("success with standby pool", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StandbyPoolSize = 1
+		config.BillingAwareScaleDown = true
+		config.ShutdownTimeout = time.Minute
+
+		// The server is deleted, without being moved to a pool nor shut down.
+		group := setupInstanceGroup(t, config,
+			[]mockutil.Request{
+				{
+					Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+					Status: 200,
+					JSON:   schema.VolumeListResponse{Volumes: []schema.Volume{}},
+				},
+				{
+					Method: "DELETE", Path: "/servers/1",
+					Status: 200,
+					JSON: schema.ServerDeleteResponse{
+						Action: schema.Action{ID: 103, Status: "running"},
+					},
+				},
+				{
+					Method: "GET", Path: "/actions?id=103&page=1&sort=status&sort=id",
+					Status: 200,
+					JSON: schema.ActionListResponse{
+						Actions: []schema.Action{
+							{ID: 103, Status: "success"},
+						},
+					},
+				},
+			},
+		)
+
+		deleted, err := group.Delete(ctx, []string{"fleeting-a:1"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"fleeting-a:1"}, deleted)
+	})
 }
 
 func TestList(t *testing.T) {
@@ -458,6 +797,7 @@ func TestList(t *testing.T) {
 						Servers: []schema.Server{
 							{ID: 1, Name: "fleeting-a"},
 							{ID: 2, Name: "fleeting-b"},
+							{ID: 3, Name: "fleeting-c", Labels: map[string]string{"fleeting-state": "standby"}},
 						},
 					},
 				},
@@ -472,6 +812,74 @@ func TestList(t *testing.T) {
 		require.Equal(t, int64(2), result[1].ID)
 		require.Equal(t, "fleeting-b", result[1].Name)
 	})
+
+	t.Run("success owner", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.Owner = "manager-1"
+
+		group := setupInstanceGroup(t, config,
+			[]mockutil.Request{
+				{
+					Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+					Status: 200,
+					JSON: schema.ServerListResponse{
+						Servers: []schema.Server{
+							{ID: 1, Name: "fleeting-a", Labels: map[string]string{"fleeting-owner": "manager-1"}},
+							{ID: 2, Name: "fleeting-b"},
+							{ID: 3, Name: "fleeting-c", Labels: map[string]string{"fleeting-owner": "manager-2"}},
+						},
+					},
+				},
+			},
+		)
+
+		result, err := group.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, result, 2)
+		require.Equal(t, "fleeting-a:1", result[0].IID())
+		require.Equal(t, "fleeting-b:2", result[1].IID())
+		require.Contains(t, group.foreignOwners, "manager-2")
+	})
+
+	t.Run("success static instances", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StaticInstancesSelector = "pool=static"
+
+		group := setupInstanceGroup(t, config,
+			[]mockutil.Request{
+				{
+					Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
+					Status: 200,
+					JSON: schema.ServerListResponse{
+						Servers: []schema.Server{
+							{ID: 1, Name: "fleeting-a", Labels: map[string]string{"instance-group": "fleeting"}},
+						},
+					},
+				},
+				{
+					Method: "GET", Path: "/servers?label_selector=pool%3Dstatic&page=1&per_page=50",
+					Status: 200,
+					JSON: schema.ServerListResponse{
+						Servers: []schema.Server{
+							{ID: 2, Name: "static-b", Labels: map[string]string{"pool": "static"}},
+							{ID: 3, Name: "static-c", Labels: map[string]string{"pool": "static", "fleeting-state": "released"}},
+							{ID: 4, Name: "other-d", Labels: map[string]string{"pool": "static", "instance-group": "other"}},
+						},
+					},
+				},
+			},
+		)
+
+		result, err := group.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, result, 2)
+		require.Equal(t, "fleeting-a:1", result[0].IID())
+		require.Equal(t, "static-b:2", result[1].IID())
+		require.False(t, result[0].Static)
+		require.True(t, result[1].Static)
+	})
 }
 
 func TestGet(t *testing.T) {
@@ -0,0 +1,251 @@
+package instancegroup
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+const (
+	// stateLabel holds the state of the resources kept in a pool, which are hidden from
+	// the instance group.
+	stateLabel = "fleeting-state"
+	// stateAvailable is the state of the volumes in the volume pool.
+	stateAvailable = "available"
+	// stateStandby is the state of the servers in the standby pool.
+	stateStandby = "standby"
+	// stateParked is the state of the servers parked until their next billing boundary.
+	stateParked = "parked"
+	// stateReleased is the state of the released static servers.
+	stateReleased = "released"
+
+	// instanceLabel holds the name of the instance a volume was created for.
+	instanceLabel = "fleeting-instance"
+	// volumeLabel holds the index of the volume config a volume was created with.
+	volumeLabel = "fleeting-volume"
+
+	// releasedAtLabel holds the unix timestamp of the resource release to a pool.
+	releasedAtLabel = "fleeting-released-at"
+	// takenAtLabel holds the unix timestamp of the server take from a pool.
+	takenAtLabel = "fleeting-taken-at"
+	// shutdownAtLabel holds the unix timestamp of the server shutdown before its
+	// deletion.
+	shutdownAtLabel = "fleeting-shutdown-at"
+
+	// sshKeyLabel holds the ID of the managed ssh key the server was created with.
+	sshKeyLabel = "fleeting-ssh-key"
+	// hostKeyLabel holds the fingerprint of the ssh host key generated for the server,
+	// see [HostKeyFingerprint].
+	hostKeyLabel = "fleeting-ssh-host-key"
+	// UsedAtLabel holds the unix timestamp of the last use of a managed ssh key.
+	UsedAtLabel = "fleeting-used-at"
+
+	// OwnerLabel holds the owner of the resources, which identifies the runner manager
+	// using the instance group.
+	OwnerLabel = "fleeting-owner"
+)
+
+// releasedLabels returns a copy of the labels, with the state and release time of a
+// resource released to a pool.
+func releasedLabels(labels map[string]string, state string) map[string]string {
+	result := make(map[string]string, len(labels)+2)
+	maps.Copy(result, labels)
+	result[stateLabel] = state
+	result[releasedAtLabel] = strconv.FormatInt(time.Now().Unix(), 10)
+	return result
+}
+
+// releasedAt returns the time a resource was released to a pool.
+func releasedAt(labels map[string]string) time.Time {
+	return timeLabel(labels, releasedAtLabel)
+}
+
+// takenAt returns the time a server was taken from a pool.
+func takenAt(labels map[string]string) time.Time {
+	return timeLabel(labels, takenAtLabel)
+}
+
+// shutdownAt returns the time a server was shut down before its deletion.
+func shutdownAt(labels map[string]string) time.Time {
+	return timeLabel(labels, shutdownAtLabel)
+}
+
+// timeLabel parses the unix timestamp of a label, or returns the zero time.
+func timeLabel(labels map[string]string, key string) time.Time {
+	value, err := strconv.ParseInt(labels[key], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(value, 0)
+}
+
+var (
+	// labelNameRegex matches a label value, or the name part of a label key.
+	labelNameRegex = regexp.MustCompile(`^([a-zA-Z0-9]([-_.a-zA-Z0-9]*[a-zA-Z0-9])?)?$`)
+	// labelPrefixRegex matches the DNS subdomain prefix of a label key.
+	labelPrefixRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// IsLabelSelector reports whether the value is a label selector, instead of a resource
+// name or ID.
+func IsLabelSelector(value string) bool {
+	return strings.ContainsAny(value, "=!()")
+}
+
+// validateLabelKey ensures the label key follows the Hetzner Cloud label syntax,
+// see https://docs.hetzner.cloud/reference/cloud#labels.
+func validateLabelKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if len(prefix) > 253 || !labelPrefixRegex.MatchString(prefix) {
+			return fmt.Errorf("invalid label key: %s: prefix must be a valid DNS subdomain", key)
+		}
+		name = rest
+	}
+	if name == "" || len(name) > 63 || !labelNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid label key: %s", key)
+	}
+	return nil
+}
+
+// validateLabelValue ensures the label value follows the Hetzner Cloud label syntax,
+// see https://docs.hetzner.cloud/reference/cloud#labels.
+func validateLabelValue(key, value string) error {
+	if len(value) > 63 || !labelNameRegex.MatchString(value) {
+		return fmt.Errorf("invalid label value: %s=%s", key, value)
+	}
+	return nil
+}
+
+// ValidateLabels ensures the label keys and the values rendered from their templates
+// (see [TemplateData]) follow the Hetzner Cloud label syntax.
+func ValidateLabels(labels map[string]string) error {
+	_, err := newLabelTemplates(labels)
+	return err
+}
+
+// newLabelTemplates parses the label value templates, and ensures they render valid
+// labels.
+func newLabelTemplates(labels map[string]string) (map[string]*template.Template, error) {
+	result := make(map[string]*template.Template, len(labels))
+	errs := make([]error, 0)
+
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		if err := validateLabelKey(key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		tmpl, err := NewTemplate("label "+key, labels[key])
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if _, err := renderLabel(tmpl, key, exampleTemplateData); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		result[key] = tmpl
+	}
+
+	return result, errors.Join(errs...)
+}
+
+func renderLabel(tmpl *template.Template, key string, data TemplateData) (string, error) {
+	value, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return "", err
+	}
+	if err := validateLabelValue(key, value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// RenderLabels renders the label templates of a resource created outside of the
+// instance group, for example the ssh key.
+func RenderLabels(labels map[string]string, data TemplateData) (map[string]string, error) {
+	templates, err := newLabelTemplates(labels)
+	if err != nil {
+		return nil, err
+	}
+	return renderLabels(templates, data)
+}
+
+// renderLabels renders the label templates.
+func renderLabels(templates map[string]*template.Template, data TemplateData) (map[string]string, error) {
+	result := make(map[string]string, len(templates)+1)
+	for key, tmpl := range templates {
+		value, err := renderLabel(tmpl, key, data)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// instanceLabels renders the labels of the resources created for an instance.
+func (g *instanceGroup) instanceLabels(data TemplateData) (map[string]string, error) {
+	result, err := renderLabels(g.labelTemplates, data)
+	if err != nil {
+		return nil, err
+	}
+	result["instance-group"] = g.name
+	if g.config.Owner != "" {
+		result[OwnerLabel] = g.config.Owner
+	}
+	if g.managedSSHKey != nil {
+		result[sshKeyLabel] = strconv.FormatInt(g.managedSSHKey.ID, 10)
+	}
+	return result, nil
+}
+
+// isOwned reports whether a resource of the instance group is owned by this instance
+// group. The resources without owner were created before the owner was introduced,
+// and are considered owned.
+func (g *instanceGroup) isOwned(labels map[string]string) bool {
+	owner, ok := labels[OwnerLabel]
+	if !ok || g.config.Owner == "" || owner == g.config.Owner {
+		return true
+	}
+
+	g.foreignOwnersMu.Lock()
+	defer g.foreignOwnersMu.Unlock()
+
+	if _, ok := g.foreignOwners[owner]; !ok {
+		if g.foreignOwners == nil {
+			g.foreignOwners = make(map[string]struct{})
+		}
+		g.foreignOwners[owner] = struct{}{}
+
+		g.log.Warn("found resources of another owner in the instance group, make sure each runner manager uses a unique instance group name or owner",
+			"owner", g.config.Owner, "other_owner", owner)
+	}
+
+	return false
+}
+
+// ownedServers removes the servers not owned by this instance group.
+func (g *instanceGroup) ownedServers(servers []*hcloud.Server) []*hcloud.Server {
+	return slices.DeleteFunc(servers, func(server *hcloud.Server) bool {
+		return !g.isOwned(server.Labels)
+	})
+}
+
+// ownedVolumes removes the volumes not owned by this instance group.
+func (g *instanceGroup) ownedVolumes(volumes []*hcloud.Volume) []*hcloud.Volume {
+	return slices.DeleteFunc(volumes, func(volume *hcloud.Volume) bool {
+		return !g.isOwned(volume.Labels)
+	})
+}
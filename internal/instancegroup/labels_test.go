@@ -0,0 +1,65 @@
+package instancegroup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLabels(t *testing.T) {
+	testCases := []struct {
+		name   string
+		labels map[string]string
+		err    string
+	}{
+		{
+			name:   "success",
+			labels: map[string]string{"key": "value", "example.com/key_1": "value.1", "empty": ""},
+		},
+		{
+			name:   "success template",
+			labels: map[string]string{"server-type": "{{ .ServerType }}", "created": `{{ now.UTC.Format "2006-01-02" }}`},
+		},
+		{
+			name:   "failure invalid key",
+			labels: map[string]string{"-key": "value"},
+			err:    "invalid label key: -key",
+		},
+		{
+			name:   "failure invalid key prefix",
+			labels: map[string]string{"Example.com/key": "value"},
+			err:    "invalid label key: Example.com/key: prefix must be a valid DNS subdomain",
+		},
+		{
+			name:   "failure key too long",
+			labels: map[string]string{strings.Repeat("a", 64): "value"},
+			err:    "invalid label key: " + strings.Repeat("a", 64),
+		},
+		{
+			name:   "failure invalid value",
+			labels: map[string]string{"key": "value with spaces"},
+			err:    "invalid label value: key=value with spaces",
+		},
+		{
+			name:   "failure invalid template value",
+			labels: map[string]string{"created": "{{ now }}"},
+			err:    "invalid label value: created=",
+		},
+		{
+			name:   "failure unknown field",
+			labels: map[string]string{"key": "{{ .Unknown }}"},
+			err:    `template: label key:1:3: executing "label key" at <.Unknown>: can't evaluate field Unknown in type instancegroup.TemplateData`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := ValidateLabels(testCase.labels)
+			if testCase.err != "" {
+				require.ErrorContains(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
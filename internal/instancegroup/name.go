@@ -0,0 +1,120 @@
+package instancegroup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultNameTemplate is the template used to name the instances when none is configured.
+const defaultNameTemplate = "{{ .GroupName }}-{{ .Random }}"
+
+// maxNameLength is the maximum length of a server name.
+const maxNameLength = 63
+
+// hostnameLabelRegex matches a hostname label as per RFC 1123.
+var hostnameLabelRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+
+// NameTemplateData holds the data available in the template used to name the instances.
+type NameTemplateData struct {
+	// GroupName is the name of the instance group.
+	GroupName string
+	// Location is the name of the location the instance is created in.
+	Location string
+	// ServerType is the name of the first server type of the instance group.
+	ServerType string
+	// Sequence is a number incremented for each instance name, starting at 1. It is
+	// reset when the plugin restarts.
+	Sequence int
+	// Random is a random suffix of 8 hexadecimal characters.
+	Random string
+}
+
+// exampleNameTemplateData is used to check that a name template renders a valid name.
+var exampleNameTemplateData = NameTemplateData{
+	GroupName:  "fleeting",
+	Location:   "hel1",
+	ServerType: "cpx22",
+	Sequence:   1,
+	Random:     "a1b2c3d4",
+}
+
+// NewNameTemplate parses a template used to name the instances with the
+// [NameTemplateData], and ensures it renders a valid name.
+//
+// The names must be unique across plugin restarts, while the sequence is reset on
+// restart, so the template must use the random suffix.
+func NewNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name template").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := renderName(tmpl, exampleNameTemplateData)
+	if err != nil {
+		return nil, err
+	}
+
+	other := exampleNameTemplateData
+	other.Random = "e5f6a7b8"
+	otherName, err := renderName(tmpl, other)
+	if err != nil {
+		return nil, err
+	}
+	if otherName == name {
+		return nil, fmt.Errorf("invalid instance name template: names must be unique, use the .Random field")
+	}
+
+	return tmpl, nil
+}
+
+func renderName(tmpl *template.Template, data NameTemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render %s: %w", tmpl.Name(), err)
+	}
+
+	name := b.String()
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// validateName ensures the name is a valid hostname as per RFC 1123, which is required
+// for the server names.
+func validateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("invalid instance name: name is empty")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("invalid instance name: %s: name is longer than %d characters", name, maxNameLength)
+	}
+	for label := range strings.SplitSeq(name, ".") {
+		if !hostnameLabelRegex.MatchString(label) {
+			return fmt.Errorf("invalid instance name: %s: name must be a valid hostname", name)
+		}
+	}
+	return nil
+}
+
+// nameTemplateData returns the data used to render the name of an instance.
+func (g *instanceGroup) nameTemplateData(sequence int, random string) NameTemplateData {
+	data := NameTemplateData{
+		GroupName: g.name,
+		Location:  g.location.Name,
+		Sequence:  sequence,
+		Random:    random,
+	}
+	if len(g.serverTypes) > 0 {
+		data.ServerType = g.serverTypes[0].Name
+	}
+	return data
+}
+
+// instanceName renders the name of a new instance.
+func (g *instanceGroup) instanceName() (string, error) {
+	return renderName(g.nameTemplate, g.nameTemplateData(int(g.nameSequence.Add(1)), g.randomIDFn()))
+}
@@ -0,0 +1,113 @@
+package instancegroup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+)
+
+func TestNewNameTemplate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		text   string
+		result string
+		err    string
+	}{
+		{
+			name:   "success default",
+			text:   defaultNameTemplate,
+			result: "fleeting-a1b2c3d4",
+		},
+		{
+			name:   "success all fields",
+			text:   `{{ .GroupName }}-{{ .Location }}-{{ .ServerType }}-{{ printf "%03d" .Sequence }}-{{ .Random }}`,
+			result: "fleeting-hel1-cpx22-001-a1b2c3d4",
+		},
+		{
+			name:   "success domain",
+			text:   "{{ .GroupName }}-{{ .Random }}.ci",
+			result: "fleeting-a1b2c3d4.ci",
+		},
+		{
+			name: "failure unknown field",
+			text: "{{ .Name }}",
+			err:  `could not render name template: template: name template:1:3: executing "name template" at <.Name>: can't evaluate field Name in type instancegroup.NameTemplateData`,
+		},
+		{
+			name: "failure invalid hostname",
+			text: "{{ .GroupName }}_{{ .Random }}",
+			err:  "invalid instance name: fleeting_a1b2c3d4: name must be a valid hostname",
+		},
+		{
+			name: "failure without random",
+			text: `{{ .GroupName }}-{{ printf "%03d" .Sequence }}`,
+			err:  "invalid instance name template: names must be unique, use the .Random field",
+		},
+		{
+			name: "failure empty",
+			text: "{{ if false }}{{ end }}",
+			err:  "invalid instance name: name is empty",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tmpl, err := NewNameTemplate(testCase.text)
+			if testCase.err != "" {
+				require.EqualError(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+
+			result, err := renderName(tmpl, exampleNameTemplateData)
+			require.NoError(t, err)
+			require.Equal(t, testCase.result, result)
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{name: "simple", value: "fleeting-a1b2c3d4", valid: true},
+		{name: "uppercase", value: "Fleeting-1", valid: true},
+		{name: "domain", value: "fleeting-1.ci.example.com", valid: true},
+		{name: "max length", value: strings.Repeat("a", 63), valid: true},
+		{name: "too long", value: strings.Repeat("a", 64), valid: false},
+		{name: "leading hyphen", value: "-fleeting", valid: false},
+		{name: "trailing hyphen", value: "fleeting-", valid: false},
+		{name: "empty label", value: "fleeting..ci", valid: false},
+		{name: "separator", value: "fleeting:1", valid: false},
+		{name: "space", value: "fleeting 1", valid: false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := validateName(testCase.value)
+			if testCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestInstanceName(t *testing.T) {
+	config := DefaultTestConfig
+	config.NameTemplate = "{{ .GroupName }}-{{ .ServerType }}-{{ .Sequence }}-{{ .Random }}"
+
+	group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+	name, err := group.instanceName()
+	require.NoError(t, err)
+	require.Equal(t, "fleeting-cpx22-1-a", name)
+
+	name, err = group.instanceName()
+	require.NoError(t, err)
+	require.Equal(t, "fleeting-cpx22-2-b", name)
+}
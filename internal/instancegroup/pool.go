@@ -0,0 +1,143 @@
+package instancegroup
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// listPooledServers returns the servers of the instance group in the given pool state.
+func listPooledServers(ctx context.Context, group *instanceGroup, state string) ([]*hcloud.Server, error) {
+	servers, err := group.client.Server.AllWithOpts(ctx,
+		hcloud.ServerListOpts{
+			ListOpts: hcloud.ListOpts{
+				LabelSelector: fmt.Sprintf("instance-group=%s,%s=%s", group.name, stateLabel, state),
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not list instances: %w", err)
+	}
+	return group.ownedServers(servers), nil
+}
+
+// takePooledServer takes the server out of its pool for the instance. The server is
+// renamed after the instance, so the instance gets a new IID, and its labels and reverse
+// DNS are updated for the instance. The take time is stored in the server labels, see
+// [Instance.CreatedAt]. The user data, the volumes and the other resources
+// derived from the instance name are not rendered again, they keep the values of the
+// instance the server was created for.
+func takePooledServer(ctx context.Context, group *instanceGroup, instance *Instance, server *hcloud.Server) error {
+	data := group.templateData(instance)
+	if server.ServerType != nil {
+		data.ServerType = server.ServerType.Name
+	}
+	instanceLabels, err := group.instanceLabels(data)
+	if err != nil {
+		return err
+	}
+
+	labels := make(map[string]string, len(server.Labels)+len(instanceLabels))
+	maps.Copy(labels, server.Labels)
+	delete(labels, stateLabel)
+	delete(labels, releasedAtLabel)
+	maps.Copy(labels, instanceLabels)
+	labels[takenAtLabel] = strconv.FormatInt(time.Now().Unix(), 10)
+	// The server keeps the ssh key it was created with
+	if value, ok := server.Labels[sshKeyLabel]; ok {
+		labels[sshKeyLabel] = value
+	}
+
+	server, _, err = group.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{
+		Name:   instance.Name,
+		Labels: labels,
+	})
+	if err != nil {
+		return fmt.Errorf("could not update instance: %w", err)
+	}
+
+	group.log.Info("taking instance from pool", "instance", instance.Name, "id", server.ID)
+
+	*instance = *group.instanceFromServer(server)
+	instance.recycled = true
+
+	handler := &ReverseDNSHandler{}
+	return handler.Create(ctx, group, instance)
+}
+
+// releasePooledServer rebuilds the instance server and moves it to the pool in the
+// given state. The parked servers are not rebuilt, so they keep their warm caches. On
+// failure, the instance is not recycled and will be deleted by the next handlers.
+// Returns whether the release was requested.
+func releasePooledServer(ctx context.Context, group *instanceGroup, instance *Instance, server *hcloud.Server, state string) bool {
+	log := group.log.With("instance", instance.Name, "id", instance.ID, "state", state)
+
+	var action *hcloud.Action
+	if state != stateParked {
+		result, _, err := group.client.Server.RebuildWithResult(ctx, server, hcloud.ServerRebuildOpts{Image: group.image})
+		if err != nil {
+			log.Warn("could not request instance rebuild, deleting instance", "err", err)
+			return false
+		}
+		action = result.Action
+	}
+
+	instance.recycled = true
+
+	instance.waitFn = func() error {
+		// Fallback to the instance deletion on failure
+		if action != nil {
+			if err := group.client.Action.WaitFor(ctx, action); err != nil {
+				log.Warn("could not rebuild instance, deleting instance", "err", err)
+				instance.recycled = false
+				return nil
+			}
+		}
+
+		_, _, err := group.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{
+			Labels: releasedLabels(server.Labels, state),
+		})
+		if err != nil {
+			log.Warn("could not move instance to pool, deleting instance", "err", err)
+			instance.recycled = false
+			return nil
+		}
+
+		log.Info("moved instance to pool")
+		return nil
+	}
+
+	return true
+}
+
+// deletePooledServers deletes the servers from their pool. The volumes attached to the
+// servers are deleted by the [VolumeHandler] sanity checks.
+func deletePooledServers(ctx context.Context, group *instanceGroup, servers []*hcloud.Server) error {
+	actions := make([]*hcloud.Action, 0, len(servers))
+	for _, server := range servers {
+		group.log.Info("deleting pooled instance", "name", server.Name, "id", server.ID, "state", server.Labels[stateLabel])
+		group.deleteInstanceKeys(server.ID)
+
+		result, _, err := group.client.Server.DeleteWithResult(ctx, server)
+		if err != nil {
+			return fmt.Errorf("could not request instance deletion: %w", err)
+		}
+		actions = append(actions, result.Action)
+	}
+
+	if err := group.client.Action.WaitFor(ctx, actions...); err != nil {
+		return fmt.Errorf("could not delete instance: %w", err)
+	}
+
+	return nil
+}
+
+// isExpired reports whether the server exceeds the max instance age, in which case it
+// must be deleted instead of being moved to a pool.
+func (g *instanceGroup) isExpired(server *hcloud.Server) bool {
+	return g.config.MaxInstanceAge > 0 && time.Now().After(InstanceFromServer(server).ExpiresAt(g.config.MaxInstanceAge))
+}
@@ -0,0 +1,147 @@
+package instancegroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+)
+
+// StaticHandler takes the instance servers from the released static servers.
+type StaticHandler struct {
+	// released holds the released static servers that can be taken.
+	released []*hcloud.Server
+}
+
+var _ PreIncreaseHandler = (*StaticHandler)(nil)
+var _ CreateHandler = (*StaticHandler)(nil)
+
+func (h *StaticHandler) PreIncrease(ctx context.Context, group *instanceGroup) error {
+	if group.config.StaticInstancesSelector == "" {
+		return nil
+	}
+
+	servers, err := group.listStaticServers(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.released = make([]*hcloud.Server, 0, len(servers))
+	for _, server := range servers {
+		if server.Labels[stateLabel] == stateReleased {
+			h.released = append(h.released, server)
+		}
+	}
+
+	return nil
+}
+
+func (h *StaticHandler) Create(ctx context.Context, group *instanceGroup, instance *Instance) error {
+	if len(h.released) == 0 {
+		return nil
+	}
+
+	server := h.released[0]
+	h.released = h.released[1:]
+
+	labels := make(map[string]string, len(server.Labels))
+	maps.Copy(labels, server.Labels)
+	delete(labels, stateLabel)
+	delete(labels, releasedAtLabel)
+
+	// The static servers belong to the user and keep their name, the instance is
+	// identified by the server ID.
+	server, _, err := group.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{
+		Labels: labels,
+	})
+	if err != nil {
+		return fmt.Errorf("could not update static instance: %w", err)
+	}
+
+	group.log.Info("taking static instance", "name", server.Name, "id", server.ID)
+
+	*instance = *group.instanceFromServer(server)
+	instance.recycled = true
+
+	return nil
+}
+
+// listStaticServers returns the servers matching the static instances selector,
+// including the released servers. The servers managed by an instance group are
+// ignored.
+func (g *instanceGroup) listStaticServers(ctx context.Context) ([]*hcloud.Server, error) {
+	if g.config.StaticInstancesSelector == "" {
+		return nil, nil
+	}
+
+	servers, err := g.client.Server.AllWithOpts(ctx,
+		hcloud.ServerListOpts{
+			ListOpts: hcloud.ListOpts{
+				LabelSelector: g.config.StaticInstancesSelector,
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not list static instances: %w", err)
+	}
+
+	result := make([]*hcloud.Server, 0, len(servers))
+	for _, server := range servers {
+		if _, ok := server.Labels["instance-group"]; ok {
+			continue
+		}
+		result = append(result, server)
+	}
+	return result, nil
+}
+
+// releaseStaticInstances releases the static instances, which are never deleted. The
+// servers are rebuilt first, depending on the [StaticDecreasePolicy].
+func (g *instanceGroup) releaseStaticInstances(ctx context.Context, instances []*Instance, servers map[int64]*hcloud.Server) ([]*Instance, error) {
+	errs := make([]error, 0)
+
+	rebuild := g.config.StaticInstancesDecreasePolicy == StaticDecreasePolicyRebuild
+
+	// Request all the rebuilds first, so the servers are rebuilt in parallel
+	actions := make(map[int64]*hcloud.Action, len(instances))
+	if rebuild {
+		for _, instance := range instances {
+			result, _, err := g.client.Server.RebuildWithResult(ctx, servers[instance.ID], hcloud.ServerRebuildOpts{Image: g.image})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not request static instance rebuild: %w", err))
+				continue
+			}
+			actions[instance.ID] = result.Action
+		}
+	}
+
+	released := make([]*Instance, 0, len(instances))
+	for _, instance := range instances {
+		if rebuild {
+			action, ok := actions[instance.ID]
+			if !ok {
+				continue
+			}
+			if err := g.client.Action.WaitFor(ctx, action); err != nil {
+				errs = append(errs, fmt.Errorf("could not rebuild static instance: %w", err))
+				continue
+			}
+		}
+
+		server := servers[instance.ID]
+		_, _, err := g.client.Server.Update(ctx, server, hcloud.ServerUpdateOpts{
+			Labels: releasedLabels(server.Labels, stateReleased),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not release static instance: %w", err))
+			continue
+		}
+
+		g.log.Info("released static instance", "name", instance.Name, "id", instance.ID, "rebuild", rebuild)
+		released = append(released, instance)
+	}
+
+	return released, errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package instancegroup
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/exp/mockutil"
+	"github.com/hetznercloud/hcloud-go/v2/hcloud/schema"
+)
+
+func TestStaticHandlerCreate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+		config.StaticInstancesSelector = "pool=static"
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{
+			{
+				Method: "GET", Path: "/servers?label_selector=pool%3Dstatic&page=1&per_page=50",
+				Status: 200,
+				JSON: schema.ServerListResponse{
+					Servers: []schema.Server{
+						{ID: 1, Name: "static-a", Labels: map[string]string{"pool": "static"}},
+						{ID: 2, Name: "static-b", Labels: map[string]string{"pool": "static", "fleeting-state": "released", "fleeting-released-at": "1"}},
+					},
+				},
+			},
+			{
+				Method: "PUT", Path: "/servers/2",
+				Want: func(t *testing.T, r *http.Request) {
+					var payload schema.ServerUpdateRequest
+					mustUnmarshal(t, r.Body, &payload)
+					require.Empty(t, payload.Name)
+					require.Equal(t, &map[string]string{"pool": "static"}, payload.Labels)
+				},
+				Status: 200,
+				JSON: schema.ServerUpdateResponse{
+					Server: schema.Server{ID: 2, Name: "static-b"},
+				},
+			},
+		})
+
+		handler := &StaticHandler{}
+		require.NoError(t, handler.PreIncrease(ctx, group))
+
+		instance := NewInstance("fleeting-a")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.True(t, instance.recycled)
+		assert.Equal(t, "static-b:2", instance.IID())
+
+		instance = NewInstance("fleeting-b")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := context.Background()
+		config := DefaultTestConfig
+
+		group := setupInstanceGroup(t, config, []mockutil.Request{})
+
+		handler := &StaticHandler{}
+		require.NoError(t, handler.PreIncrease(ctx, group))
+
+		instance := NewInstance("fleeting-a")
+		require.NoError(t, handler.Create(ctx, group, instance))
+		assert.False(t, instance.recycled)
+	})
+}
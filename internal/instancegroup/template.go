@@ -0,0 +1,132 @@
+package instancegroup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData holds the data available in the templates rendered for each instance.
+type TemplateData struct {
+	// Name of the instance.
+	Name string
+	// GroupName is the name of the instance group.
+	GroupName string
+	// Location is the name of the location the instance is created in.
+	Location string
+	// ServerType is the name of the server type the instance is created with.
+	ServerType string
+	// Architecture is the architecture of the instance server types.
+	Architecture string
+	// PrivateNetworks are the private networks the instance is attached to.
+	PrivateNetworks []TemplateNetwork
+	// Labels are the rendered labels of the instance, they are not available in the
+	// instance label templates.
+	Labels map[string]string
+}
+
+// TemplateNetwork holds the data of a private network available in the templates.
+//
+// The instance IP in a private network is assigned during the server creation, and
+// is therefore not available in the templates.
+type TemplateNetwork struct {
+	// ID of the network.
+	ID int64
+	// Name of the network.
+	Name string
+	// IPRange is the IP range (CIDR) of the network.
+	IPRange string
+	// AliasIPs are the alias IPs of the instance in the network.
+	AliasIPs []string
+}
+
+// exampleTemplateData is used to check that a template can be rendered.
+var exampleTemplateData = TemplateData{
+	Name:         "fleeting-a1b2c3d4",
+	GroupName:    "fleeting",
+	Location:     "hel1",
+	ServerType:   "cpx22",
+	Architecture: "x86",
+	PrivateNetworks: []TemplateNetwork{
+		{ID: 1, Name: "network", IPRange: "10.0.0.0/16", AliasIPs: []string{"10.0.2.1"}},
+	},
+	Labels: map[string]string{"instance-group": "fleeting"},
+}
+
+// templateFuncs are the helper functions available in the templates.
+var templateFuncs = template.FuncMap{
+	// env returns the value of an environment variable.
+	"env": os.Getenv,
+	// now returns the current time.
+	"now": time.Now,
+	// file returns the content of a file.
+	"file": func(path string) (string, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	},
+}
+
+// NewTemplate parses a template rendered for each instance with the [TemplateData], and
+// ensures it can be rendered.
+func NewTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tmpl.Execute(io.Discard, exampleTemplateData); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+func renderTemplate(tmpl *template.Template, data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("could not render %s: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+func (g *instanceGroup) templateData(instance *Instance) TemplateData {
+	data := TemplateData{
+		Name:            instance.Name,
+		GroupName:       g.name,
+		Location:        g.location.Name,
+		Architecture:    string(g.serverTypesArchitecture),
+		PrivateNetworks: make([]TemplateNetwork, 0, len(g.privateNetworks)),
+	}
+
+	// The labels are rendered from the other template data, they are only available
+	// once rendered, or from the server.
+	if instance.Server != nil {
+		data.Labels = instance.Server.Labels
+	}
+
+	if instance.Server != nil && instance.Server.ServerType != nil {
+		data.ServerType = instance.Server.ServerType.Name
+	} else if len(g.serverTypes) > 0 {
+		// Resources created before the server use the preferred server type
+		data.ServerType = g.serverTypes[0].Name
+	}
+
+	for _, network := range g.privateNetworks {
+		templateNetwork := TemplateNetwork{
+			ID:   network.ID,
+			Name: network.Name,
+		}
+		if network.IPRange != nil {
+			templateNetwork.IPRange = network.IPRange.String()
+		}
+		data.PrivateNetworks = append(data.PrivateNetworks, templateNetwork)
+	}
+
+	return data
+}
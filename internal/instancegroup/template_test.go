@@ -0,0 +1,63 @@
+package instancegroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTemplate(t *testing.T) {
+	t.Setenv("FLEETING_TEST_VALUE", "from-env")
+
+	path := filepath.Join(t.TempDir(), "value")
+	require.NoError(t, os.WriteFile(path, []byte("from-file"), 0o600))
+
+	testCases := []struct {
+		name   string
+		text   string
+		result string
+		err    string
+	}{
+		{
+			name:   "success",
+			text:   "{{ .Name }} {{ .GroupName }} {{ .Location }} {{ .ServerType }} {{ .Architecture }}",
+			result: "fleeting-a1b2c3d4 fleeting hel1 cpx22 x86",
+		},
+		{
+			name:   "success private networks and labels",
+			text:   "{{ range .PrivateNetworks }}{{ .Name }} {{ .IPRange }} {{ .AliasIPs }}{{ end }} {{ .Labels }}",
+			result: "network 10.0.0.0/16 [10.0.2.1] map[instance-group:fleeting]",
+		},
+		{
+			name:   "success env and file",
+			text:   `{{ env "FLEETING_TEST_VALUE" }} {{ file "` + path + `" }}`,
+			result: "from-env from-file",
+		},
+		{
+			name: "failure unknown field",
+			text: "{{ .Unknown }}",
+			err:  `template: test:1:3: executing "test" at <.Unknown>: can't evaluate field Unknown in type instancegroup.TemplateData`,
+		},
+		{
+			name: "failure missing file",
+			text: `{{ file "/does/not/exist" }}`,
+			err:  `template: test:1:3: executing "test" at <file "/does/not/exist">: error calling file: open /does/not/exist: no such file or directory`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			tmpl, err := NewTemplate("test", testCase.text)
+			if testCase.err != "" {
+				require.EqualError(t, err, testCase.err)
+				return
+			}
+			require.NoError(t, err)
+
+			result, err := renderTemplate(tmpl, exampleTemplateData)
+			require.NoError(t, err)
+			require.Equal(t, testCase.result, result)
+		})
+	}
+}
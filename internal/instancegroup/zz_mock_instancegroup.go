@@ -55,6 +55,21 @@ func (mr *MockInstanceGroupMockRecorder) Decrease(ctx, iids any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decrease", reflect.TypeOf((*MockInstanceGroup)(nil).Decrease), ctx, iids)
 }
 
+// Delete mocks base method.
+func (m *MockInstanceGroup) Delete(ctx context.Context, iids []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, iids)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockInstanceGroupMockRecorder) Delete(ctx, iids any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockInstanceGroup)(nil).Delete), ctx, iids)
+}
+
 // Get mocks base method.
 func (m *MockInstanceGroup) Get(ctx context.Context, iid string) (*Instance, error) {
 	m.ctrl.T.Helper()
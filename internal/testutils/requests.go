@@ -11,7 +11,7 @@ var (
 		Status: 200,
 		JSON: schema.LocationListResponse{
 			Locations: []schema.Location{
-				{ID: 3, Name: "hel1"},
+				{ID: 3, Name: "hel1", NetworkZone: "eu-central"},
 			},
 		},
 	}
@@ -61,6 +61,20 @@ var (
 		},
 	}
 
+	GetStandbyServersRequest = mockutil.Request{
+		Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dstandby&page=1&per_page=50",
+		Status: 200,
+		JSON: schema.ServerListResponse{
+			Servers: []schema.Server{},
+		},
+	}
+	GetParkedServersRequest = mockutil.Request{
+		Method: "GET", Path: "/servers?label_selector=instance-group%3Dfleeting%2Cfleeting-state%3Dparked&page=1&per_page=50",
+		Status: 200,
+		JSON: schema.ServerListResponse{
+			Servers: []schema.Server{},
+		},
+	}
 	GetVolumesRequest = mockutil.Request{
 		Method: "GET", Path: "/volumes?label_selector=instance-group%3Dfleeting&page=1&per_page=50",
 		Status: 200,
@@ -0,0 +1,31 @@
+package hetzner
+
+import (
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+// isExpired reports whether the instance exceeds the max instance age, see
+// [instancegroup.Instance.ExpiresAt]. The static instances never expire.
+func (g *InstanceGroup) isExpired(instance *instancegroup.Instance) bool {
+	return g.MaxInstanceAge > 0 && !instance.Static && time.Now().After(instance.ExpiresAt(time.Duration(g.MaxInstanceAge)))
+}
+
+// expireInstances reports the running instances exceeding the max instance age as
+// deleting, even if they are in use. The runner then removes the instances through
+// its usual removal path.
+func (g *InstanceGroup) expireInstances(instances []*instancegroup.Instance, states map[string]provider.State) {
+	for _, instance := range instances {
+		id := instance.IID()
+
+		if states[id] != provider.StateRunning || !g.isExpired(instance) {
+			continue
+		}
+
+		g.log.Debug("reporting expired instance", "id", id, "age", time.Since(instance.CreatedAt()).Round(time.Second))
+		states[id] = provider.StateDeleting
+	}
+}
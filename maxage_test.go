@@ -0,0 +1,27 @@
+package hetzner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+func TestIsExpired(t *testing.T) {
+	group := &InstanceGroup{MaxInstanceAge: Duration(time.Hour)}
+
+	old := &instancegroup.Instance{ID: 1, Server: &hcloud.Server{Created: time.Now().Add(-2 * time.Hour)}}
+	recent := &instancegroup.Instance{ID: 2, Server: &hcloud.Server{Created: time.Now()}}
+	static := &instancegroup.Instance{ID: 3, Server: &hcloud.Server{Created: time.Now().Add(-2 * time.Hour)}, Static: true}
+
+	assert.True(t, group.isExpired(old))
+	assert.False(t, group.isExpired(recent))
+	assert.False(t, group.isExpired(static))
+
+	group.MaxInstanceAge = 0
+	assert.False(t, group.isExpired(old))
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"math"
 	"net/http"
-	"net/netip"
 	"path"
+	"slices"
 	"time"
 
 	"github.com/hashicorp/go-hclog"
@@ -34,25 +34,87 @@ type InstanceGroup struct {
 	UserData     string        `json:"user_data"`
 	UserDataFile string        `json:"user_data_file"`
 
-	VolumeSize int `json:"volume_size"`
+	UserDataTemplate bool `json:"user_data_template"`
 
-	PublicIPv4Disabled   bool   `json:"public_ipv4_disabled"`
-	PublicIPv6Disabled   bool   `json:"public_ipv6_disabled"`
-	PublicIPPoolEnabled  bool   `json:"public_ip_pool_enabled"`
-	PublicIPPoolSelector string `json:"public_ip_pool_selector"`
+	VolumeSize      int    `json:"volume_size"`
+	VolumeFormat    string `json:"volume_format"`
+	VolumeMountPath string `json:"volume_mount_path"`
+
+	Volumes               []VolumeConfig `json:"volumes"`
+	VolumePoolSize        int            `json:"volume_pool_size"`
+	VolumePoolIdleTimeout Duration       `json:"volume_pool_idle_timeout"`
+
+	StandbyPoolSize        int      `json:"standby_pool_size"`
+	StandbyPoolIdleTimeout Duration `json:"standby_pool_idle_timeout"`
+
+	BillingAwareScaleDown bool     `json:"billing_aware_scale_down"`
+	BillingBoundaryMargin Duration `json:"billing_boundary_margin"`
+
+	PublicIPv4Disabled     bool   `json:"public_ipv4_disabled"`
+	PublicIPv6Disabled     bool   `json:"public_ipv6_disabled"`
+	PublicIPv6HostOffset   uint64 `json:"public_ipv6_host_offset"`
+	PublicIPPoolEnabled    bool   `json:"public_ip_pool_enabled"`
+	PublicIPPoolSelector   string `json:"public_ip_pool_selector"`
+	PublicIPPoolIPv4Policy string `json:"public_ip_pool_ipv4_policy"`
+	PublicIPPoolIPv6Policy string `json:"public_ip_pool_ipv6_policy"`
+
+	SSHKeys           []string `json:"ssh_keys"`
+	SSHKeyPerInstance bool     `json:"ssh_key_per_instance"`
+
+	SSHHostKeyVerification bool `json:"ssh_host_key_verification"`
+
+	ReadinessProbeEnabled         bool `json:"readiness_probe_enabled"`
+	ReadinessProbeUseExternalAddr bool `json:"readiness_probe_use_external_addr"`
+
+	CreationTimeout       Duration `json:"creation_timeout"`
+	CreationTimeoutPolicy string   `json:"creation_timeout_policy"`
+
+	MaxInstanceAge       Duration `json:"max_instance_age"`
+	MaxInstanceAgePolicy string   `json:"max_instance_age_policy"`
+
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
 
 	PrivateNetworks []string `json:"private_networks"`
 
+	InternalNetwork             string `json:"internal_network"`
+	InternalNetworkIPRange      string `json:"internal_network_ip_range"`
+	InternalNetworkAliasIPRange string `json:"internal_network_alias_ip_range"`
+	InternalNetworkAliasIPCount int    `json:"internal_network_alias_ip_count"`
+
+	StaticInstances               string `json:"static_instances"`
+	StaticInstancesDecreasePolicy string `json:"static_instances_decrease_policy"`
+
+	NameTemplate       string `json:"name_template"`
+	ReverseDNSTemplate string `json:"reverse_dns_template"`
+
+	AddressPreference []string `json:"address_preference"`
+
+	Owner  string            `json:"owner"`
 	Labels map[string]string `json:"labels"`
 
 	sshKey *hcloud.SSHKey
-	labels map[string]string
+	// sshKeyUploaded is set when the ssh key was uploaded by this runner process.
+	sshKeyUploaded bool
+	labels         map[string]string
 
 	log      hclog.Logger
 	settings provider.Settings
 
 	size int
 
+	// sanityAt is the time of the last sanity check.
+	sanityAt time.Time
+
+	// readyInstances holds the instances that passed the readiness probe.
+	readyInstances map[string]bool
+	// unverifiableInstances holds the instances whose ssh host key is unknown.
+	unverifiableInstances map[string]bool
+
+	// reapedInstances holds the instances reported as stuck in creation.
+	reapedInstances map[string]bool
+	// reapedCount is the number of instances reaped since the plugin started.
+	reapedCount int
+
 	client *hcloud.Client
 	group  instancegroup.InstanceGroup
 
@@ -92,7 +154,9 @@ func (g *InstanceGroup) Init(ctx context.Context, log hclog.Logger, settings pro
 	g.client = hcloud.NewClient(clientOptions...)
 
 	// Prepare credentials
-	if !g.settings.UseStaticCredentials {
+	if g.SSHKeyPerInstance {
+		g.log.Info("using per instance ssh keys")
+	} else if !g.settings.UseStaticCredentials {
 		g.log.Info("generating ssh key")
 		sshPrivateKey, sshPublicKey, err := sshutil.GenerateKeyPair()
 		if err != nil {
@@ -120,21 +184,60 @@ func (g *InstanceGroup) Init(ctx context.Context, log hclog.Logger, settings pro
 
 	// Create instance group
 	groupConfig := instancegroup.Config{
-		Location:             g.Location,
-		ServerTypes:          g.ServerTypes,
-		Image:                g.Image,
-		UserData:             g.UserData,
-		PublicIPv4Disabled:   g.PublicIPv4Disabled,
-		PublicIPv6Disabled:   g.PublicIPv6Disabled,
-		PublicIPPoolEnabled:  g.PublicIPPoolEnabled,
-		PublicIPPoolSelector: g.PublicIPPoolSelector,
-		PrivateNetworks:      g.PrivateNetworks,
-		Labels:               g.labels,
-		VolumeSize:           g.VolumeSize,
+		Location:                      g.Location,
+		ServerTypes:                   g.ServerTypes,
+		Image:                         g.Image,
+		UserData:                      g.UserData,
+		UserDataTemplate:              g.UserDataTemplate,
+		PublicIPv4Disabled:            g.PublicIPv4Disabled,
+		PublicIPv6Disabled:            g.PublicIPv6Disabled,
+		PublicIPv6HostOffset:          g.PublicIPv6HostOffset,
+		PublicIPPoolEnabled:           g.PublicIPPoolEnabled,
+		PublicIPPoolSelector:          g.PublicIPPoolSelector,
+		PublicIPPoolIPv4Policy:        instancegroup.IPPoolPolicy(g.PublicIPPoolIPv4Policy),
+		PublicIPPoolIPv6Policy:        instancegroup.IPPoolPolicy(g.PublicIPPoolIPv6Policy),
+		PrivateNetworks:               g.PrivateNetworks,
+		InternalNetwork:               g.InternalNetwork,
+		InternalNetworkIPRange:        g.InternalNetworkIPRange,
+		InternalNetworkAliasIPRange:   g.InternalNetworkAliasIPRange,
+		InternalNetworkAliasIPCount:   g.InternalNetworkAliasIPCount,
+		Labels:                        g.labels,
+		VolumeSize:                    g.VolumeSize,
+		VolumeFormat:                  g.VolumeFormat,
+		VolumeMountPath:               g.VolumeMountPath,
+		Volumes:                       make([]instancegroup.VolumeConfig, 0, len(g.Volumes)),
+		VolumePoolSize:                g.VolumePoolSize,
+		VolumePoolIdleTimeout:         time.Duration(g.VolumePoolIdleTimeout),
+		StandbyPoolSize:               g.StandbyPoolSize,
+		StandbyPoolIdleTimeout:        time.Duration(g.StandbyPoolIdleTimeout),
+		BillingAwareScaleDown:         g.BillingAwareScaleDown,
+		BillingBoundaryMargin:         time.Duration(g.BillingBoundaryMargin),
+		ShutdownTimeout:               time.Duration(g.ShutdownTimeout),
+		MaxInstanceAge:                time.Duration(g.MaxInstanceAge),
+		StaticInstancesSelector:       g.StaticInstances,
+		StaticInstancesDecreasePolicy: instancegroup.StaticDecreasePolicy(g.StaticInstancesDecreasePolicy),
+		NameTemplate:                  g.NameTemplate,
+		Owner:                         g.Owner,
+		InstanceSSHKeys:               g.SSHKeyPerInstance,
+		InstanceHostKeys:              g.SSHHostKeyVerification,
+		ReverseDNSTemplate:            g.ReverseDNSTemplate,
+	}
+
+	for _, volume := range g.Volumes {
+		groupConfig.Volumes = append(groupConfig.Volumes, instancegroup.VolumeConfig{
+			Size:      volume.Size,
+			Format:    volume.Format,
+			Labels:    volume.Labels,
+			MountPath: volume.MountPath,
+		})
 	}
 
+	groupConfig.SSHKeys = slices.Clone(g.SSHKeys)
 	if g.sshKey != nil {
-		groupConfig.SSHKeys = []string{g.sshKey.Name}
+		groupConfig.SSHKeys = append(groupConfig.SSHKeys, g.sshKey.Name)
+		if g.isManagedSSHKey() {
+			groupConfig.ManagedSSHKey = g.sshKey.Name
+		}
 	}
 
 	g.group = instancegroup.New(g.client, g.log, g.Name, groupConfig)
@@ -169,17 +272,33 @@ func (g *InstanceGroup) Update(ctx context.Context, update func(string, provider
 
 	g.size = len(instances)
 
+	states := make(map[string]provider.State, len(instances))
+
+	// The pools and the ssh keys must be reconciled even without scaling activity.
+	if (g.hasPools() || g.isManagedSSHKey()) && time.Since(g.sanityAt) >= sanityInterval {
+		g.sanity(ctx)
+	}
+
 	for _, instance := range instances {
 		id := instance.IID()
 
+		// The servers shut down before their deletion are labeled, past the shutdown
+		// timeout, the deletion is considered failed and the status is used instead.
+		if shutdownAt := instance.ShutdownAt(); !shutdownAt.IsZero() &&
+			time.Since(shutdownAt) < time.Duration(g.ShutdownTimeout)+shutdownGracePeriod {
+			states[id] = provider.StateDeleting
+			continue
+		}
+
 		var state provider.State
 
 		switch instance.Server.Status {
 		case hcloud.ServerStatusStopping, hcloud.ServerStatusDeleting:
 			state = provider.StateDeleting
 
-		// Server creation always go through `initializing` and `off`. Since we never
-		// shutdown servers, we can assume that "off" is still in the creation phase.
+		// Server creation always go through `initializing` and `off`. Since the servers
+		// shut down before their deletion are handled above, we can assume that "off" is
+		// still in the creation phase.
 		case hcloud.ServerStatusOff:
 			state = provider.StateCreating
 
@@ -198,7 +317,27 @@ func (g *InstanceGroup) Update(ctx context.Context, update func(string, provider
 			continue
 		}
 
-		update(id, state)
+		states[id] = state
+	}
+
+	// Verifying the ssh host key requires to probe the instances.
+	if g.ReadinessProbeEnabled || g.SSHHostKeyVerification {
+		g.probeInstances(ctx, instances, states)
+	}
+
+	if g.CreationTimeout > 0 {
+		g.reapInstances(ctx, instances, states)
+	}
+
+	if g.MaxInstanceAge > 0 && g.MaxInstanceAgePolicy == MaxInstanceAgeReport {
+		g.expireInstances(instances, states)
+	}
+
+	for _, instance := range instances {
+		id := instance.IID()
+		if state, ok := states[id]; ok {
+			update(id, state)
+		}
 	}
 
 	return nil
@@ -221,14 +360,23 @@ func (g *InstanceGroup) Increase(ctx context.Context, delta int) (int, error) {
 
 	g.size += len(created)
 
-	if sanityErr := g.group.Sanity(ctx, false); sanityErr != nil {
-		g.log.Error("sanity check failed", "error", sanityErr)
-	}
+	g.sanity(ctx)
 
 	return len(created), err
 }
 
 func (g *InstanceGroup) Decrease(ctx context.Context, iids []string) ([]string, error) {
+	return g.decrease(ctx, iids, g.group.Decrease)
+}
+
+// deleteInstances deletes the instances without moving them to a pool, see
+// [instancegroup.InstanceGroup.Delete]. The instances are not shut down first, so the
+// deletion does not block the updates for up to the shutdown timeout.
+func (g *InstanceGroup) deleteInstances(ctx context.Context, iids []string) ([]string, error) {
+	return g.decrease(ctx, iids, g.group.Delete)
+}
+
+func (g *InstanceGroup) decrease(ctx context.Context, iids []string, decrease func(context.Context, []string) ([]string, error)) ([]string, error) {
 	if len(iids) == 0 {
 		return nil, nil
 	}
@@ -239,7 +387,7 @@ func (g *InstanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 		return nil, err
 	}
 
-	deleted, err := g.group.Decrease(ctx, iids)
+	deleted, err := decrease(ctx, iids)
 
 	op.Increase(hcloud.IsError(err,
 		hcloud.ErrorCodeResourceUnavailable,
@@ -249,11 +397,29 @@ func (g *InstanceGroup) Decrease(ctx context.Context, iids []string) ([]string,
 
 	g.size -= len(deleted)
 
+	g.sanity(ctx)
+
+	return deleted, err
+}
+
+// shutdownGracePeriod is the duration after the shutdown timeout during which the
+// servers shut down before their deletion are reported as deleting.
+const shutdownGracePeriod = time.Minute
+
+// sanityInterval is the minimum interval between the sanity checks run during an update.
+const sanityInterval = time.Minute
+
+func (g *InstanceGroup) sanity(ctx context.Context) {
+	g.sanityAt = time.Now()
+
 	if sanityErr := g.group.Sanity(ctx, false); sanityErr != nil {
 		g.log.Error("sanity check failed", "error", sanityErr)
 	}
+}
 
-	return deleted, err
+// hasPools reports whether resources are kept in pools, which expire over time.
+func (g *InstanceGroup) hasPools() bool {
+	return g.VolumePoolSize > 0 || g.StandbyPoolSize > 0 || g.BillingAwareScaleDown
 }
 
 func (g *InstanceGroup) ConnectInfo(ctx context.Context, iid string) (provider.ConnectInfo, error) {
@@ -267,6 +433,13 @@ func (g *InstanceGroup) ConnectInfo(ctx context.Context, iid string) (provider.C
 	info.ID = iid
 	info.OS = instance.Server.Image.OSFlavor
 
+	if g.SSHKeyPerInstance {
+		if instance.SSHPrivateKey == nil {
+			return info, fmt.Errorf("could not get instance ssh key: unknown ssh key for instance: %s", iid)
+		}
+		info.Key = instance.SSHPrivateKey
+	}
+
 	switch instance.Server.ServerType.Architecture {
 	case hcloud.ArchitectureX86:
 		info.Arch = "amd64"
@@ -276,34 +449,74 @@ func (g *InstanceGroup) ConnectInfo(ctx context.Context, iid string) (provider.C
 		g.log.Warn("unsupported architecture", "architecture", instance.Server.ServerType.Architecture)
 	}
 
-	switch {
-	case !instance.Server.PublicNet.IPv4.IsUnspecified():
-		info.ExternalAddr = instance.Server.PublicNet.IPv4.IP.String()
-	case !instance.Server.PublicNet.IPv6.IsUnspecified():
-		network, ok := netip.AddrFromSlice(instance.Server.PublicNet.IPv6.IP)
-		if ok {
-			info.ExternalAddr = network.Next().String()
-		} else {
-			return info, fmt.Errorf("could not parse server public ipv6: %s", instance.Server.PublicNet.IPv6.IP.String())
-		}
+	info.ExternalAddr, err = g.externalAddr(instance)
+	if err != nil {
+		return info, err
 	}
 
-	if len(instance.Server.PrivateNet) > 0 {
-		info.InternalAddr = instance.Server.PrivateNet[0].IP.String()
+	if ip := instance.InternalIP(); ip != nil {
+		info.InternalAddr = ip.String()
 	}
 
 	return info, err
 }
 
-func (g *InstanceGroup) Heartbeat(_ context.Context, _ string) error {
-	// no-op
+// externalAddr returns the address used to connect to the instance, following the
+// address preference.
+func (g *InstanceGroup) externalAddr(instance *instancegroup.Instance) (string, error) {
+	preferences := g.AddressPreference
+	if len(preferences) == 0 {
+		preferences = defaultAddressPreference
+	}
+
+	for _, preference := range preferences {
+		switch preference {
+		case AddressIPv4:
+			if !instance.Server.PublicNet.IPv4.IsUnspecified() {
+				return instance.Server.PublicNet.IPv4.IP.String(), nil
+			}
+		case AddressIPv6:
+			if !instance.Server.PublicNet.IPv6.IsUnspecified() {
+				ipv6, err := instance.PublicIPv6()
+				if err != nil {
+					return "", err
+				}
+				return ipv6.String(), nil
+			}
+		case AddressInternal:
+			if ip := instance.InternalIP(); ip != nil {
+				return ip.String(), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func (g *InstanceGroup) Heartbeat(ctx context.Context, iid string) error {
+	if g.MaxInstanceAge == 0 {
+		return nil
+	}
+
+	instance, err := g.group.Get(ctx, iid)
+	if err != nil {
+		return fmt.Errorf("could not get instance: %w", err)
+	}
+
+	// Failing the heartbeat removes the idle instance.
+	if g.isExpired(instance) {
+		return fmt.Errorf("instance exceeded the max instance age: %s", iid)
+	}
+
 	return nil
 }
 
 func (g *InstanceGroup) Shutdown(ctx context.Context) error {
 	errs := make([]error, 0)
 
-	if g.sshKey != nil {
+	// Only delete the ssh key uploaded by this runner process, the ssh keys left over
+	// are deleted by the sanity checks once they are no longer used.
+	if g.sshKey != nil && g.sshKeyUploaded {
 		g.log.Debug("deleting ssh key", "id", fmt.Sprint(g.sshKey.ID))
 		_, err := g.client.SSHKey.Delete(ctx, g.sshKey)
 		if err != nil {
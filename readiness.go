@@ -0,0 +1,148 @@
+package hetzner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+// probeTimeout is the deadline of a readiness probe, the probes run concurrently so an
+// update waits at most for a single deadline.
+const probeTimeout = 3 * time.Second
+
+// probeInstances probes the running instances, and reports them as creating until their
+// connector port is ready. The instances found ready are cached, and are not probed
+// again.
+func (g *InstanceGroup) probeInstances(ctx context.Context, instances []*instancegroup.Instance, states map[string]provider.State) {
+	port := g.settings.ProtocolPort
+	if port == 0 {
+		port = provider.DefaultProtocolPorts[g.settings.Protocol]
+	}
+
+	ready := make(map[string]bool, len(instances))
+	unverifiable := make(map[string]bool)
+	readyMu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+
+	for _, instance := range instances {
+		id := instance.IID()
+
+		if states[id] != provider.StateRunning {
+			continue
+		}
+		if g.readyInstances[id] {
+			ready[id] = true
+			continue
+		}
+		if g.SSHHostKeyVerification && instance.SSHHostKey == nil && instance.SSHHostKeyFingerprint() == "" {
+			// The host keys of the instances created without host key label are unknown,
+			// these instances never become ready and are left to the reaper.
+			if !g.unverifiableInstances[id] {
+				g.log.Warn("instance ssh host key is unknown, the instance will never be ready, use creation_timeout to delete it",
+					"id", id)
+			}
+			unverifiable[id] = true
+			continue
+		}
+
+		addr, err := g.probeAddr(instance)
+		if err != nil || addr == "" {
+			g.log.Debug("could not get instance address", "id", id, "error", err)
+			continue
+		}
+
+		wg.Go(func() {
+			err := g.probe(ctx, instance, net.JoinHostPort(addr, strconv.Itoa(port)))
+			switch {
+			case err == nil:
+				readyMu.Lock()
+				ready[id] = true
+				readyMu.Unlock()
+			case errors.Is(err, errHostKeyMismatch):
+				g.log.Error("could not verify ssh host key", "id", id, "error", err)
+			default:
+				g.log.Debug("instance not ready", "id", id, "error", err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	for id, state := range states {
+		if state == provider.StateRunning && !ready[id] {
+			states[id] = provider.StateCreating
+		}
+	}
+
+	g.readyInstances = ready
+	g.unverifiableInstances = unverifiable
+}
+
+// probeAddr returns the address the runner connects to, which is the internal address
+// unless the runner uses the external address, like the fleeting connectors.
+func (g *InstanceGroup) probeAddr(instance *instancegroup.Instance) (string, error) {
+	var internalAddr string
+	if ip := instance.InternalIP(); ip != nil {
+		internalAddr = ip.String()
+	}
+
+	if internalAddr != "" && !g.ReadinessProbeUseExternalAddr {
+		return internalAddr, nil
+	}
+
+	externalAddr, err := g.externalAddr(instance)
+	if err != nil {
+		return "", err
+	}
+	if externalAddr == "" {
+		return internalAddr, nil
+	}
+	return externalAddr, nil
+}
+
+// probe checks that the instance accepts connections on its connector port. With ssh
+// host key verification, the host must also present the instance host key.
+func (g *InstanceGroup) probe(ctx context.Context, instance *instancegroup.Instance, addr string) error {
+	if g.SSHHostKeyVerification {
+		// The host keys are kept in memory, only their fingerprint survives a restart.
+		if instance.SSHHostKey == nil {
+			return verifyHostKeyFingerprint(ctx, addr, instance.SSHHostKeyFingerprint())
+		}
+		return verifyHostKey(ctx, addr, instance.SSHHostKey)
+	}
+
+	conn, err := dialProbe(ctx, addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// dialProbe connects to the address, the connection deadline is set to the probe
+// deadline.
+func dialProbe(ctx context.Context, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to instance: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not connect to instance: %w", err)
+	}
+
+	return conn, nil
+}
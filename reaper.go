@@ -0,0 +1,68 @@
+package hetzner
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/gitlab-org/fleeting/fleeting/provider"
+
+	"gitlab.com/hetznercloud/fleeting-plugin-hetzner/internal/instancegroup"
+)
+
+// reapInstances handles the instances stuck in creation for longer than the creation
+// timeout, measured from the instance creation (see [instancegroup.Instance.CreatedAt]).
+// Depending on the creation timeout policy, the instances are deleted, or reported as
+// timed out.
+func (g *InstanceGroup) reapInstances(ctx context.Context, instances []*instancegroup.Instance, states map[string]provider.State) {
+	reaped := make(map[string]bool, len(g.reapedInstances))
+	stuck := make([]string, 0)
+
+	for _, instance := range instances {
+		id := instance.IID()
+
+		if states[id] != provider.StateCreating || instance.Static {
+			continue
+		}
+
+		age := time.Since(instance.CreatedAt())
+		if age < time.Duration(g.CreationTimeout) {
+			continue
+		}
+
+		if g.CreationTimeoutPolicy == CreationTimeoutReport {
+			// The instances are listed until they are deleted, only log them once.
+			if !g.reapedInstances[id] {
+				g.reapedCount++
+				g.log.Warn("reporting instance stuck in creation",
+					"id", id, "status", instance.Server.Status, "age", age.Round(time.Second), "reaped", g.reapedCount)
+			}
+			reaped[id] = true
+			states[id] = provider.StateTimeout
+			continue
+		}
+
+		g.log.Warn("deleting instance stuck in creation",
+			"id", id, "status", instance.Server.Status, "age", age.Round(time.Second))
+		stuck = append(stuck, id)
+	}
+
+	g.reapedInstances = reaped
+
+	if len(stuck) == 0 {
+		return
+	}
+
+	// The stuck instances must not be reused, nor shut down gracefully.
+	deleted, err := g.deleteInstances(ctx, stuck)
+	if err != nil {
+		g.log.Error("could not delete instances stuck in creation", "error", err)
+	}
+
+	for _, id := range deleted {
+		g.reapedCount++
+		states[id] = provider.StateDeleting
+	}
+	if len(deleted) > 0 {
+		g.log.Info("deleted instances stuck in creation", "count", len(deleted), "reaped", g.reapedCount)
+	}
+}